@@ -0,0 +1,74 @@
+// Command reencrypt moves every snippet and TOTP secret onto the newest encryption key. Run
+// it after adding a key to the end of the keyring (and restarting the web application with
+// the new keyring), then the old key can be removed once it reports that nothing is left.
+//
+// It also encrypts any snippets which were stored before encryption was turned on, and
+// redoes every content hash as an HMAC under the newest key.
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"log"
+	"os"
+
+	_ "github.com/go-sql-driver/mysql"
+
+	"snippetbox/internal/envelope"
+	"snippetbox/internal/models"
+)
+
+func main() {
+	dsn := flag.String("dsn", "web:Pyth0n!sta24@/snippetbox?parseTime=true", "MySQL data source name")
+	keysFile := flag.String("keys-file", "", "File of keys for encrypting snippets, one id:base64-key per line (defaults to $SNIPPETBOX_KEYS)")
+	batch := flag.Int("batch", 100, "Number of rows to re-encrypt in each transaction")
+	flag.Parse()
+
+	infoLog := log.New(os.Stdout, "INFO\t", log.Ldate|log.Ltime)
+	errorLog := log.New(os.Stderr, "ERROR\t", log.Ldate|log.Ltime|log.Lshortfile)
+
+	keys, err := envelope.LoadKeyring(*keysFile, "SNIPPETBOX_KEYS")
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+	if keys == nil {
+		errorLog.Fatal("no -keys-file or $SNIPPETBOX_KEYS set")
+	}
+
+	db, err := sql.Open("mysql", *dsn)
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+	defer db.Close()
+
+	if err = db.Ping(); err != nil {
+		errorLog.Fatal(err)
+	}
+
+	snippets := &models.SnippetModel{DB: db, Keys: keys}
+	twoFactor := &models.TwoFactorModel{DB: db, Keys: keys}
+
+	snippetTotal := reencryptAll(infoLog, errorLog, "snippets", snippets.Reencrypt, *batch)
+	secretTotal := reencryptAll(infoLog, errorLog, "TOTP secrets", twoFactor.Reencrypt, *batch)
+
+	infoLog.Printf("done: re-encrypted %d snippets and %d TOTP secrets, all of them now use key %q", snippetTotal, secretTotal, keys.CurrentID())
+}
+
+// reencryptAll calls reencrypt until it has nothing left to do, and returns how many rows
+// it moved in all. Working in batches means no one transaction holds locks on the whole
+// table.
+func reencryptAll(infoLog, errorLog *log.Logger, what string, reencrypt func(limit int) (int, error), batch int) int {
+	total := 0
+	for {
+		n, err := reencrypt(batch)
+		if err != nil {
+			errorLog.Fatal(err)
+		}
+		if n == 0 {
+			return total
+		}
+
+		total += n
+		infoLog.Printf("re-encrypted %d %s", total, what)
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"snippetbox/internal/mailer"
+	"snippetbox/internal/models"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// activationLifetime is how long the link in a verification email works for. After that
+// the user can ask for another from their account page.
+const activationLifetime = 3 * 24 * time.Hour
+
+// activationResendInterval is how long a user has to wait between verification emails,
+// so the resend button can't be used to flood somebody's inbox.
+const activationResendInterval = 5 * time.Minute
+
+// sendActivationEmail emails a user a link to verify their address with.
+func (app *application) sendActivationEmail(email string) error {
+	token, err := newToken()
+	if err != nil {
+		return err
+	}
+
+	expires := time.Now().Add(activationLifetime)
+
+	err = app.tokens.Insert(email, models.ScopeActivation, token, expires)
+	if err != nil {
+		return err
+	}
+
+	msg := mailer.Message{
+		To:      email,
+		Subject: "Verify your Snippetbox email address",
+		Body: fmt.Sprintf("Hello,\n\n"+
+			"Thanks for signing up to Snippetbox! Before you can post snippets, please verify your email address by opening this link:\n\n%s/user/activate/%s\n\n"+
+			"The link works until %s. If you didn't sign up, you can ignore this email.\n\n"+
+			"-- Snippetbox\n",
+			app.baseURL, token, humanDate(expires)),
+	}
+
+	return app.mailer.Send(msg)
+}
+
+// activation shows the page a verification link leads to. The address isn't verified
+// until the button on it is pressed: some mail scanners follow every link in an email,
+// and they shouldn't be able to verify an address for someone.
+func (app *application) activation(w http.ResponseWriter, r *http.Request) {
+	token := httprouter.ParamsFromContext(r.Context()).ByName("token")
+
+	_, err := app.tokens.UserID(token, models.ScopeActivation)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.invalidActivationLink(w, r)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.ActivationToken = token
+
+	app.render(w, http.StatusOK, "activate.tmpl", data)
+}
+
+// activationPost verifies the address. The token is proof enough, so the user doesn't
+// need to be logged in: they might be opening the link on another device.
+func (app *application) activationPost(w http.ResponseWriter, r *http.Request) {
+	token := httprouter.ParamsFromContext(r.Context()).ByName("token")
+
+	userID, err := app.tokens.Consume(token, models.ScopeActivation)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.invalidActivationLink(w, r)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	err = app.users.Activate(userID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Thanks, your email address has been verified!")
+
+	if app.isAuthenticated(r) {
+		http.Redirect(w, r, "/snippet/create", http.StatusSeeOther)
+		return
+	}
+
+	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+}
+
+// activationResendPost sends the user another verification email, unless we sent them one
+// only a few minutes ago.
+func (app *application) activationResendPost(w http.ResponseWriter, r *http.Request) {
+	user, err := app.users.Get(app.authenticatedUserID(r))
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	if user.Activated {
+		app.sessionManager.Put(r.Context(), "flash", "Your email address has already been verified.")
+		http.Redirect(w, r, "/account/view", http.StatusSeeOther)
+		return
+	}
+
+	last, err := app.tokens.LastIssued(user.ID, models.ScopeActivation)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	if time.Since(last) < activationResendInterval {
+		app.sessionManager.Put(r.Context(), "flash", "We sent you a verification email a few minutes ago. Please check your inbox, or try again later.")
+		http.Redirect(w, r, "/account/view", http.StatusSeeOther)
+		return
+	}
+
+	err = app.sendActivationEmail(user.Email)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("We've sent a new verification link to %s.", user.Email))
+
+	http.Redirect(w, r, "/account/view", http.StatusSeeOther)
+}
+
+// invalidActivationLink sends someone with a used, expired or mistyped verification link
+// to their account page, where they can ask for a new one.
+func (app *application) invalidActivationLink(w http.ResponseWriter, r *http.Request) {
+	app.sessionManager.Put(r.Context(), "flash", "That verification link is invalid or has expired. You can ask for a new one from your account page.")
+
+	http.Redirect(w, r, "/account/view", http.StatusSeeOther)
+}
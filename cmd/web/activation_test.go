@@ -0,0 +1,137 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"snippetbox/internal/assert"
+)
+
+func TestUserSignupSendsVerification(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	_, _, body := ts.get(t, "/user/signup")
+	csrfToken := extractCSRFToken(t, body)
+
+	tests := []struct {
+		name     string
+		email    string
+		wantCode int
+		wantBody string
+	}{
+		{"Valid", "dave@example.com", http.StatusSeeOther, ""},
+		{"Duplicate email", "dupe@example.com", http.StatusUnprocessableEntity, "Email address is already in use"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("name", "Dave")
+			form.Add("email", tt.email)
+			form.Add("password", "validPa$$word")
+			form.Add("csrf_token", csrfToken)
+
+			code, _, body := ts.postForm(t, "/user/signup", form)
+
+			assert.Equal(t, code, tt.wantCode)
+			assert.Equal(t, strings.Contains(body, tt.wantBody), true)
+		})
+	}
+
+	// Only the successful signup gets an email.
+	mailer := app.mailer.(*testMailer)
+	assert.Equal(t, len(mailer.messages), 1)
+	assert.Equal(t, mailer.messages[0].To, "dave@example.com")
+	assert.Equal(t, strings.Contains(mailer.messages[0].Body, "https://snippetbox.test/user/activate/"), true)
+}
+
+func TestRequireActivation(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	ts.loginAs(t, "dave@example.com")
+
+	code, headers, _ := ts.get(t, "/snippet/create")
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, headers.Get("Location"), "/account/view")
+
+	code, _, body := ts.get(t, "/account/view")
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, strings.Contains(body, "Please verify your email address before creating snippets"), true)
+	assert.Equal(t, strings.Contains(body, "Resend verification email"), true)
+
+	form := url.Values{}
+	form.Add("title", "Too soon")
+	form.Add("content", "hello")
+	form.Add("expires", "7")
+	form.Add("csrf_token", extractCSRFToken(t, body))
+
+	code, headers, _ = ts.postForm(t, "/snippet/create", form)
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, headers.Get("Location"), "/account/view")
+}
+
+func TestActivationResend(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	ts.loginAs(t, "dave@example.com")
+
+	_, _, body := ts.get(t, "/account/view")
+	csrfToken := extractCSRFToken(t, body)
+
+	// The first request sends an email, the second is too soon after it.
+	tests := []struct {
+		name      string
+		wantFlash string
+		wantMails int
+	}{
+		{"First", "We&#39;ve sent a new verification link to dave@example.com", 1},
+		{"Too soon", "We sent you a verification email a few minutes ago", 1},
+	}
+
+	mailer := app.mailer.(*testMailer)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, headers, _ := ts.postForm(t, "/account/activation/resend", url.Values{"csrf_token": {csrfToken}})
+			assert.Equal(t, code, http.StatusSeeOther)
+			assert.Equal(t, headers.Get("Location"), "/account/view")
+
+			_, _, body := ts.get(t, "/account/view")
+			assert.Equal(t, strings.Contains(body, tt.wantFlash), true)
+			assert.Equal(t, len(mailer.messages), tt.wantMails)
+		})
+	}
+}
+
+func TestActivation(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	code, headers, _ := ts.get(t, "/user/activate/nonsense")
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, headers.Get("Location"), "/account/view")
+
+	ts.loginAs(t, "dave@example.com")
+
+	code, _, body := ts.get(t, "/user/activate/dave-activation-token")
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, strings.Contains(body, "<form action='/user/activate/dave-activation-token'"), true)
+	csrfToken := extractCSRFToken(t, body)
+
+	code, headers, _ = ts.postForm(t, "/user/activate/nonsense", url.Values{"csrf_token": {csrfToken}})
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, headers.Get("Location"), "/account/view")
+
+	code, headers, _ = ts.postForm(t, "/user/activate/dave-activation-token", url.Values{"csrf_token": {csrfToken}})
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, headers.Get("Location"), "/snippet/create")
+}
@@ -3,3 +3,8 @@ package main
 type contextKey string
 
 const isAuthenticatedContextKey = contextKey("isAuthenticated")
+const isAdminContextKey = contextKey("isAdmin")
+
+// The organizations the user belongs to, loaded by authenticate for the nav bar's switcher
+// and for authorize.
+const membershipsContextKey = contextKey("memberships")
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"snippetbox/internal/models"
+	"snippetbox/internal/validator"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// The Atom (RFC 4287) and RSS 2.0 documents we generate. Only the elements we fill in
+// are declared.
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Author  atomAuthor  `xml:"author"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomEntry struct {
+	ID        string      `xml:"id"`
+	Title     string      `xml:"title"`
+	Published string      `xml:"published"`
+	Updated   string      `xml:"updated"`
+	Link      atomLink    `xml:"link"`
+	Content   atomContent `xml:"content"`
+}
+
+type atomContent struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate,omitempty"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string  `xml:"title"`
+	Link        string  `xml:"link"`
+	GUID        rssGUID `xml:"guid"`
+	PubDate     string  `xml:"pubDate"`
+	Description string  `xml:"description"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+func (app *application) feedAtom(w http.ResponseWriter, r *http.Request) {
+	snippets, err := app.snippets.Latest()
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.writeAtom(w, r, "Latest snippets", "/feed.atom", snippets)
+}
+
+func (app *application) feedRSS(w http.ResponseWriter, r *http.Request) {
+	snippets, err := app.snippets.Latest()
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.writeRSS(w, r, "Latest snippets", "/feed.rss", snippets)
+}
+
+// feedUser serves /feeds/user/:feed, where :feed is the user ID followed by the format,
+// like "12.atom" or "12.rss". httprouter can't match a parameter followed by a suffix in
+// the same path segment, so we split them apart here.
+func (app *application) feedUser(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	name, format, _ := strings.Cut(params.ByName("feed"), ".")
+
+	id, err := strconv.Atoi(name)
+	if err != nil || id < 1 || (format != "atom" && format != "rss") {
+		app.notFound(w)
+		return
+	}
+
+	exists, err := app.users.Exists(id)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	if !exists {
+		app.notFound(w)
+		return
+	}
+
+	snippets, err := app.snippets.LatestByUser(id)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	title := fmt.Sprintf("Snippets by user #%d", id)
+	self := fmt.Sprintf("/feeds/user/%d.%s", id, format)
+
+	if format == "atom" {
+		app.writeAtom(w, r, title, self, snippets)
+	} else {
+		app.writeRSS(w, r, title, self, snippets)
+	}
+}
+
+// feedTag serves /feeds/tag/:feed, where :feed is the tag followed by the format, like
+// "golang.atom", split apart in the same way as feedUser(). A tag nobody has used yet
+// gets an empty feed rather than a 404, so people can subscribe to it ahead of time.
+func (app *application) feedTag(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	tag, format, _ := strings.Cut(params.ByName("feed"), ".")
+
+	if !validator.Matches(tag, validator.TagRX) || (format != "atom" && format != "rss") {
+		app.notFound(w)
+		return
+	}
+
+	snippets, err := app.snippets.LatestByTag(tag)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	title := fmt.Sprintf("Snippets tagged %s", tag)
+	self := fmt.Sprintf("/feeds/tag/%s.%s", tag, format)
+
+	if format == "atom" {
+		app.writeAtom(w, r, title, self, snippets)
+	} else {
+		app.writeRSS(w, r, title, self, snippets)
+	}
+}
+
+func (app *application) writeAtom(w http.ResponseWriter, r *http.Request, title, self string, snippets []*models.Snippet) {
+	// Atom insists on an updated time, even for a feed with no entries.
+	updated := feedUpdated(snippets)
+	if updated.IsZero() {
+		updated = time.Now().UTC()
+	}
+
+	feed := atomFeed{
+		ID:      app.baseURL + self,
+		Title:   title + " - Snippetbox",
+		Updated: updated.Format(time.RFC3339),
+		Links: []atomLink{
+			{Href: app.baseURL + self, Rel: "self", Type: "application/atom+xml"},
+			{Href: app.baseURL + "/", Rel: "alternate", Type: "text/html"},
+		},
+		Author: atomAuthor{Name: "Snippetbox"},
+	}
+
+	for _, s := range snippets {
+		link := fmt.Sprintf("%s/snippet/view/%d", app.baseURL, s.ID)
+		feed.Entries = append(feed.Entries, atomEntry{
+			ID:        link,
+			Title:     s.Title,
+			Published: s.PublishAt.UTC().Format(time.RFC3339),
+			Updated:   s.PublishAt.UTC().Format(time.RFC3339),
+			Link:      atomLink{Href: link, Rel: "alternate", Type: "text/html"},
+			Content:   atomContent{Type: "text", Body: feedContent(s)},
+		})
+	}
+
+	app.writeFeed(w, r, "application/atom+xml; charset=utf-8", feed, feedUpdated(snippets))
+}
+
+func (app *application) writeRSS(w http.ResponseWriter, r *http.Request, title, self string, snippets []*models.Snippet) {
+	feed := rssFeed{
+		Version: "2.0",
+		Channel: rssChannel{
+			Title:       title + " - Snippetbox",
+			Link:        app.baseURL + "/",
+			Description: title + " on Snippetbox",
+		},
+	}
+
+	if len(snippets) > 0 {
+		feed.Channel.LastBuildDate = feedUpdated(snippets).Format(time.RFC1123Z)
+	}
+
+	for _, s := range snippets {
+		link := fmt.Sprintf("%s/snippet/view/%d", app.baseURL, s.ID)
+		feed.Channel.Items = append(feed.Channel.Items, rssItem{
+			Title:       s.Title,
+			Link:        link,
+			GUID:        rssGUID{IsPermaLink: true, Value: link},
+			PubDate:     s.PublishAt.UTC().Format(time.RFC1123Z),
+			Description: feedContent(s),
+		})
+	}
+
+	app.writeFeed(w, r, "application/rss+xml; charset=utf-8", feed, feedUpdated(snippets))
+}
+
+// writeFeed encodes a feed and sends it with the validators feed readers use to poll
+// cheaply: Last-Modified is the newest publication time, and the ETag is a hash of the
+// document itself, so it changes whenever anything in the feed does. http.ServeContent()
+// answers conditional requests with a 304 for us.
+func (app *application) writeFeed(w http.ResponseWriter, r *http.Request, contentType string, feed any, updated time.Time) {
+	buf := new(bytes.Buffer)
+	buf.WriteString(xml.Header)
+
+	err := xml.NewEncoder(buf).Encode(feed)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	sum := sha256.Sum256(buf.Bytes())
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:16])+`"`)
+
+	http.ServeContent(w, r, "", updated, bytes.NewReader(buf.Bytes()))
+}
+
+// encryptedNotice stands in for the content of an encrypted snippet anywhere we'd
+// otherwise quote it, such as feeds and link previews.
+const encryptedNotice = "This snippet is encrypted. Open the link it was shared with to read it."
+
+// feedContent returns what a feed entry should show of the snippet's content.
+func feedContent(s *models.Snippet) string {
+	if s.ClientEncrypted {
+		return encryptedNotice
+	}
+	return s.Content
+}
+
+// feedUpdated returns the publication time of the newest snippet, or the zero time (which
+// makes http.ServeContent() leave out Last-Modified) if there are none.
+func feedUpdated(snippets []*models.Snippet) time.Time {
+	var updated time.Time
+	for _, s := range snippets {
+		if s.PublishAt.After(updated) {
+			updated = s.PublishAt
+		}
+	}
+	return updated.UTC()
+}
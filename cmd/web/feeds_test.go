@@ -0,0 +1,129 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"snippetbox/internal/assert"
+)
+
+func TestFeeds(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	tests := []struct {
+		name            string
+		urlPath         string
+		wantCode        int
+		wantContentType string
+		wantBody        string
+	}{
+		{
+			name:            "Atom",
+			urlPath:         "/feed.atom",
+			wantCode:        http.StatusOK,
+			wantContentType: "application/atom+xml; charset=utf-8",
+			wantBody:        "<id>https://snippetbox.test/snippet/view/1</id>",
+		},
+		{
+			name:            "RSS",
+			urlPath:         "/feed.rss",
+			wantCode:        http.StatusOK,
+			wantContentType: "application/rss+xml; charset=utf-8",
+			wantBody:        "<link>https://snippetbox.test/snippet/view/1</link>",
+		},
+		{
+			name:            "User Atom",
+			urlPath:         "/feeds/user/1.atom",
+			wantCode:        http.StatusOK,
+			wantContentType: "application/atom+xml; charset=utf-8",
+			wantBody:        "<title>An old silent pond</title>",
+		},
+		{
+			name:     "Unknown user",
+			urlPath:  "/feeds/user/99.rss",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Unknown format",
+			urlPath:  "/feeds/user/1.json",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:            "Tag RSS",
+			urlPath:         "/feeds/tag/haiku.rss",
+			wantCode:        http.StatusOK,
+			wantContentType: "application/rss+xml; charset=utf-8",
+			wantBody:        "<title>Snippets tagged haiku - Snippetbox</title>",
+		},
+		{
+			name:            "Tag Atom",
+			urlPath:         "/feeds/tag/poetry.atom",
+			wantCode:        http.StatusOK,
+			wantContentType: "application/atom+xml; charset=utf-8",
+			wantBody:        "<id>https://snippetbox.test/feeds/tag/poetry.atom</id>",
+		},
+		{
+			name:     "Invalid tag",
+			urlPath:  "/feeds/tag/C++.rss",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Tag unknown format",
+			urlPath:  "/feeds/tag/haiku.json",
+			wantCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, headers, body := ts.get(t, tt.urlPath)
+
+			assert.Equal(t, code, tt.wantCode)
+			if tt.wantCode == http.StatusOK {
+				assert.Equal(t, headers.Get("Content-Type"), tt.wantContentType)
+				assert.Equal(t, headers.Get("ETag") != "", true)
+				assert.Equal(t, headers.Get("Last-Modified") != "", true)
+				assert.Equal(t, strings.Contains(body, tt.wantBody), true)
+			}
+		})
+	}
+}
+
+// TestFeedTagUnused checks that a tag with no snippets yet still has a (valid, empty) feed.
+func TestFeedTagUnused(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	code, headers, body := ts.get(t, "/feeds/tag/rust.atom")
+
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, headers.Get("Content-Type"), "application/atom+xml; charset=utf-8")
+	assert.Equal(t, strings.Contains(body, "<title>Snippets tagged rust - Snippetbox</title>"), true)
+	assert.Equal(t, strings.Contains(body, "<entry>"), false)
+}
+
+func TestFeedConditionalGet(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	_, headers, _ := ts.get(t, "/feed.atom")
+
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/feed.atom", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("If-None-Match", headers.Get("ETag"))
+
+	rs, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs.Body.Close()
+
+	assert.Equal(t, rs.StatusCode, http.StatusNotModified)
+}
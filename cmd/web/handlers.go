@@ -1,12 +1,19 @@
 package main
 
 import (
+	"archive/zip"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
+	"snippetbox/internal/formatter"
+	"snippetbox/internal/langdetect"
 	"snippetbox/internal/models"
+	"snippetbox/internal/secrets"
 	"snippetbox/internal/validator"
 
 	"github.com/julienschmidt/httprouter" // New import
@@ -21,6 +28,15 @@ type snippetCreateForm struct {
 	Title               string `form:"title"`
 	Content             string `form:"content"`
 	Expires             int    `form:"expires"`
+	PublishAt           string `form:"publish_at"`
+	Noindex             bool   `form:"noindex"`
+	Language            string `form:"language"`
+	Tags                string `form:"tags"` // separated by commas or spaces
+	ClientEncrypted     bool   `form:"client_encrypted"`
+	OrgID               int    `form:"org_id"` // post to this organization instead of personally
+	Action              string `form:"action"` // "format" to tidy the content up instead of publishing
+	PublishAnyway       bool   `form:"publish_anyway"`
+	SecretsFound        bool   `form:"-"`
 	validator.Validator `form:"-"`
 }
 
@@ -31,6 +47,50 @@ type userSignupForm struct {
 	validator.Validator `form:"-"`
 }
 
+type snippetReportForm struct {
+	Reason              string `form:"reason"`
+	validator.Validator `form:"-"`
+}
+
+type snippetAliasForm struct {
+	Alias               string `form:"alias"`
+	validator.Validator `form:"-"`
+}
+
+// reservedAliases can't be claimed by a snippet, so that they stay free for pages of our own
+// and can't be used to pass a snippet off as one.
+var reservedAliases = []string{
+	"about", "account", "admin", "api", "create", "feed", "help", "login", "logout",
+	"new", "ping", "raw", "robots", "signup", "sitemap", "snippet", "static", "trending", "user",
+}
+
+type snippetLanguageForm struct {
+	Language            string `form:"language"`
+	validator.Validator `form:"-"`
+}
+
+type snippetStarForm struct {
+	Starred             bool `form:"starred"`
+	validator.Validator `form:"-"`
+}
+
+type snippetNoindexForm struct {
+	Noindex             bool `form:"noindex"`
+	validator.Validator `form:"-"`
+}
+
+type moderationForm struct {
+	Action              string `form:"action"`
+	validator.Validator `form:"-"`
+}
+
+type accountPasswordUpdateForm struct {
+	CurrentPassword         string `form:"currentPassword"`
+	NewPassword             string `form:"newPassword"`
+	NewPasswordConfirmation string `form:"newPasswordConfirmation"`
+	validator.Validator     `form:"-"`
+}
+
 type userLoginForm struct {
 	Email               string `form:"email"`
 	Password            string `form:"password"`
@@ -79,12 +139,280 @@ func (app *application) snippetView(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	app.showSnippet(w, r, snippet)
+
+} // end of snippetView
+
+// snippetViewAlias shows the snippet which has claimed the alias in the URL, exactly as
+// snippetView would.
+func (app *application) snippetViewAlias(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	snippet, err := app.snippets.GetByAlias(params.ByName("alias"))
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	app.showSnippet(w, r, snippet)
+}
+
+// showSnippet renders the view page for a snippet, however it was looked up.
+func (app *application) showSnippet(w http.ResponseWriter, r *http.Request, snippet *models.Snippet) {
+	ok, err := app.authorize(r, snippet, models.PermissionView)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	if !ok {
+		app.notFound(w)
+		return
+	}
+
+	// Owners looking at their own snippets don't make them any more popular. A failure to
+	// count a view isn't worth failing the request over.
+	if snippet.UserID == 0 || snippet.UserID != app.authenticatedUserID(r) {
+		err := app.snippets.RecordView(snippet.ID)
+		if err != nil {
+			app.errorLog.Output(2, fmt.Sprintf("record view: %s", err))
+		}
+	}
+
+	data, err := app.newSnippetTemplateData(w, r, snippet)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	data.Form = snippetReportForm{}
+
+	app.render(w, http.StatusOK, "view.tmpl", data)
+}
+
+// newSnippetTemplateData returns the templateData for rendering view.tmpl with the snippet.
+func (app *application) newSnippetTemplateData(w http.ResponseWriter, r *http.Request, snippet *models.Snippet) (*templateData, error) {
 	data := app.newTemplateData(r)
 	data.Snippet = snippet
 
-	app.render(w, http.StatusOK, "view.tmpl", data)
+	// What the current user may do decides which controls the page offers them. Only the
+	// owner (or their organization's admins) get the sharing panel, with the list of who
+	// it's shared with, and the alias, language and noindex settings.
+	canEdit, err := app.authorize(r, snippet, models.PermissionEdit)
+	if err != nil {
+		return nil, err
+	}
+	data.CanEdit = canEdit
 
-} // end of snippetView
+	data.CanShare, err = app.authorize(r, snippet, models.PermissionOwner)
+	if err != nil {
+		return nil, err
+	}
+
+	if data.CanShare {
+		data.Grants, err = app.acls.ForSnippet(snippet.ID)
+		if err != nil {
+			return nil, err
+		}
+		data.ShareForm = snippetShareForm{Permission: models.PermissionView}
+	}
+	// Encrypted snippets are decrypted by the browser, which lays out the lines itself.
+	// Otherwise, with ?format=true the content is shown formatted, if we know how.
+	if !snippet.ClientEncrypted {
+		content := snippet.Content
+
+		if r.URL.Query().Get("format") == "true" && formatter.Supports(snippet.Language) {
+			formatted, err := formatter.Format(snippet.Language, content)
+			if err != nil {
+				data.FormatError = err.Error()
+			} else {
+				content = formatted
+				data.Formatted = true
+			}
+		}
+
+		data.Lines = numberLines(content, r.URL.Query().Get("lines"))
+	}
+
+	data.Stars, data.Starred, err = app.snippets.Stars(snippet.ID, app.authenticatedUserID(r))
+	if err != nil {
+		return nil, err
+	}
+
+	// Ask search engines to skip the snippet if the owner has opted out, using both the
+	// header and (for crawlers which only look at the HTML) a meta tag.
+	if snippet.Noindex {
+		w.Header().Set("X-Robots-Tag", "noindex")
+		data.Robots = "noindex"
+	}
+
+	// Link previews are only for snippets which anyone could open.
+	if snippet.Public() {
+		data.OpenGraph = app.newOpenGraph(snippet)
+	}
+
+	return data, nil
+}
+
+// authorizedSnippet fetches the snippet named by the :id parameter and checks that the
+// current user has the given permission on it. If anything is wrong it sends the error
+// response itself and returns nil: Not Found if the user isn't allowed to see the snippet
+// at all (so we don't give away that it exists), or Forbidden if they can see it but not
+// do this to it.
+func (app *application) authorizedSnippet(w http.ResponseWriter, r *http.Request, permission string) *models.Snippet {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return nil
+	}
+
+	snippet, err := app.snippets.Get(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return nil
+	}
+
+	ok, err := app.authorize(r, snippet, permission)
+	if err != nil {
+		app.serverError(w, err)
+		return nil
+	}
+	if ok {
+		return snippet
+	}
+
+	if permission != models.PermissionView {
+		canView, err := app.authorize(r, snippet, models.PermissionView)
+		if err != nil {
+			app.serverError(w, err)
+			return nil
+		}
+		if canView {
+			app.clientError(w, http.StatusForbidden)
+			return nil
+		}
+	}
+
+	app.notFound(w)
+	return nil
+}
+
+// snippetAlias shows the form for picking a snippet's /s/ alias. Like the language and the
+// noindex flag, the alias is the owner's to choose: co-editors can change what a snippet
+// says, but not where it's published or how.
+func (app *application) snippetAlias(w http.ResponseWriter, r *http.Request) {
+	snippet := app.authorizedSnippet(w, r, models.PermissionOwner)
+	if snippet == nil {
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Snippet = snippet
+	data.Form = snippetAliasForm{Alias: snippet.Alias}
+
+	app.render(w, http.StatusOK, "alias.tmpl", data)
+}
+
+func (app *application) snippetAliasPost(w http.ResponseWriter, r *http.Request) {
+	snippet := app.authorizedSnippet(w, r, models.PermissionOwner)
+	if snippet == nil {
+		return
+	}
+
+	var form snippetAliasForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	// A blank alias is allowed, it releases the snippet's current one.
+	form.Alias = strings.ToLower(strings.TrimSpace(form.Alias))
+	if form.Alias != "" {
+		form.CheckField(validator.Matches(form.Alias, validator.AliasRX), "alias", "This field must be 3-64 lowercase letters, digits or dashes")
+		form.CheckField(!validator.PermittedValue(form.Alias, reservedAliases...), "alias", "This alias is reserved")
+	}
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Snippet = snippet
+		data.Form = form
+		app.render(w, http.StatusUnprocessableEntity, "alias.tmpl", data)
+		return
+	}
+
+	err = app.snippets.SetAlias(snippet.ID, form.Alias)
+	if err != nil {
+		if errors.Is(err, models.ErrDuplicateAlias) {
+			form.AddFieldError("alias", "This alias is already taken")
+
+			data := app.newTemplateData(r)
+			data.Snippet = snippet
+			data.Form = form
+			app.render(w, http.StatusUnprocessableEntity, "alias.tmpl", data)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	if form.Alias == "" {
+		app.sessionManager.Put(r.Context(), "flash", "Alias removed")
+		http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", snippet.ID), http.StatusSeeOther)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Alias saved")
+	http.Redirect(w, r, "/s/"+form.Alias, http.StatusSeeOther)
+}
+
+// snippetRaw serves the bare content of a snippet as plain text, for curl and friends.
+func (app *application) snippetRaw(w http.ResponseWriter, r *http.Request) {
+	snippet := app.authorizedSnippet(w, r, models.PermissionView)
+	if snippet == nil {
+		return
+	}
+
+	// The content hash makes a natural strong ETag. http.ServeContent() takes care of
+	// If-None-Match (and Range) requests for us once the header is set.
+	content := snippet.Content
+	etag := snippet.Hash
+
+	// With ?lines=12-20 only those lines are returned. Each range is a different
+	// representation of the snippet, so it needs its own ETag. Ciphertext has no lines to
+	// speak of, so encrypted snippets are always served whole.
+	if lineRange := r.URL.Query().Get("lines"); lineRange != "" && !snippet.ClientEncrypted {
+		lines := splitLines(snippet.Content)
+
+		start, end, ok := parseLineRange(lineRange, len(lines))
+		if !ok {
+			app.clientError(w, http.StatusBadRequest)
+			return
+		}
+
+		content = strings.Join(lines[start-1:end], "\n") + "\n"
+		etag = fmt.Sprintf("%s-L%d-%d", snippet.Hash, start, end)
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("ETag", fmt.Sprintf(`"%s"`, etag))
+	if snippet.Noindex {
+		w.Header().Set("X-Robots-Tag", "noindex")
+	}
+
+	// Snippets can be edited, so Last-Modified has to be when the content last changed
+	// rather than when the snippet was created.
+	http.ServeContent(w, r, "", snippet.Updated, strings.NewReader(content))
+}
 
 // Add a new snippetCreate handler, which for now returns a placeholder
 // response. We'll update this shortly to show a HTML form.
@@ -94,10 +422,17 @@ func (app *application) snippetCreate(w http.ResponseWriter, r *http.Request) {
 	// Notice how this is also a great opportunity to set any default or 'initial'
 	// values for the form --- here we set the initial value for the snippet expiry
 	// to 365 days
-	data.Form = snippetCreateForm{
+	form := snippetCreateForm{
 		Expires: 365,
 	}
 
+	// Post to the organization picked in the nav bar, if there is one.
+	if data.CurrentOrg != nil {
+		form.OrgID = data.CurrentOrg.OrgID
+	}
+
+	data.Form = form
+
 	app.render(w, http.StatusOK, "create.tmpl", data)
 }
 
@@ -131,37 +466,177 @@ func (app *application) snippetCreatePost(w http.ResponseWriter, r *http.Request
 	// For example, in the first line here we check that the form.Title field is not blank.
 	// In the second, we check that the form.Title fiels has a maximum character length of 100
 	// and so on
+	if form.Action == "format" {
+		app.snippetCreateFormat(w, r, form)
+		return
+	}
+
 	form.CheckField(validator.NotBlank(form.Title), "title", "This field cannot be blank")
 	form.CheckField(validator.MaxChars(form.Title, 100), "title", "This field cannot be more than 100 characters long")
 	form.CheckField(validator.NotBlank(form.Content), "content", "This field cannot be blank")
 	form.CheckField(validator.PermittedValue(form.Expires, 1, 7, 365), "expires", "This field must equal 1, 7 or 365")
+	form.CheckField(form.Language == "" || validator.PermittedValue(form.Language, langdetect.Languages...), "language", "This field must be one of the listed languages")
+	form.CheckField(form.OrgID == 0 || app.orgRole(r, form.OrgID) != "", "org_id", "You can only post to organizations you're a member of")
+
+	tags := parseTags(form.Tags)
+	checkTags(&form.Validator, tags)
+
+	// Snippets encrypted in the browser arrive as ciphertext. We can't check what's inside,
+	// only that it's in the format our script produces.
+	if form.ClientEncrypted {
+		form.CheckField(validator.Matches(form.Content, validator.CiphertextRX), "content", "This field must be encrypted in the browser, which needs JavaScript")
+	}
+
+	// The publication time is optional. It comes from a datetime-local input, which has
+	// no time zone, and is read as UTC like every other time on the site.
+	var publishAt time.Time
+	if validator.NotBlank(form.PublishAt) {
+		publishAt, err = time.Parse("2006-01-02T15:04", form.PublishAt)
+		form.CheckField(err == nil, "publish_at", "This field must be a valid date and time")
+		form.CheckField(err != nil || publishAt.After(time.Now()), "publish_at", "This field must be in the future")
+	}
+
+	// If the user has told us the content is in a language we can parse, make sure it
+	// does parse, rather than publishing something broken. (We don't do this for languages
+	// we've only guessed: a wrong guess would make the snippet impossible to post.)
+	if form.Valid() && !form.ClientEncrypted && formatter.Supports(form.Language) {
+		_, err = formatter.Format(form.Language, form.Content)
+		var syntaxErr *formatter.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			form.AddFieldError("content", fmt.Sprintf("This isn't valid %s. %s", form.Language, syntaxErr))
+		} else if err != nil {
+			app.serverError(w, err)
+			return
+		}
+	}
 
 	// Use the valid() method to see if any of the checks failed. If they did,
 	// then re-render the template passing in the form in the same way as before
 	if !form.Valid() {
+		// Sending ciphertext back would just get it encrypted a second time, and we can't
+		// send the plain text because we never had it.
+		if form.ClientEncrypted {
+			form.Content = ""
+			form.AddFieldError("content", "Please enter this again: it was encrypted before it was sent, so we can't show it to you")
+		}
+
 		data := app.newTemplateData(r)
 		data.Form = form
 		app.render(w, http.StatusUnprocessableEntity, "create.tmpl", data)
 		return
 	}
 
+	// Check the content for anything that looks like a credential before it gets published.
+	// Unless the user has already seen the warning and ticked "publish anyway", list the
+	// offending lines as non-field errors and give them the chance to clean things up.
+	var findings []secrets.Finding
+	if !form.ClientEncrypted {
+		findings = app.secretScanner.Scan(form.Content)
+	}
+	if len(findings) > 0 && !form.PublishAnyway {
+		for _, f := range findings {
+			form.AddNonFieldError(fmt.Sprintf("Line %d looks like it contains a secret (%s)", f.Line, f.Detector))
+		}
+		form.SecretsFound = true
+
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, http.StatusUnprocessableEntity, "create.tmpl", data)
+		return
+	}
+
+	// If the user already has an identical snippet which hasn't expired, in the same
+	// organization (or none), send them to it rather than storing a second copy.
+	dupID, err := app.snippets.FindDuplicate(app.authenticatedUserID(r), form.OrgID, form.Content)
+	if err == nil {
+		app.sessionManager.Put(r.Context(), "flash", "You've already posted this snippet")
+		http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", dupID), http.StatusSeeOther)
+		return
+	} else if !errors.Is(err, models.ErrNoRecord) {
+		app.serverError(w, err)
+		return
+	}
+
+	// Most people don't say what language their snippet is in, so unless they did, guess
+	// from the content (and the title, in case it's a file name).
+	guess := langdetect.Guess{Language: form.Language, Confidence: 1}
+	if form.Language == "" && !form.ClientEncrypted {
+		guess = langdetect.Detect(form.Title, form.Content)
+	}
+
 	// We also need to update this line to pass the data from the snippetCreateForm
 	// instance to our Insert() method.
-	id, err := app.snippets.Insert(form.Title, form.Content, form.Expires)
+	id, err := app.snippets.Insert(form.Title, form.Content, form.Expires, app.authenticatedUserID(r), publishAt, form.Noindex, guess.Language, guess.Confidence, form.ClientEncrypted, form.OrgID)
 	if err != nil {
 		app.serverError(w, err)
 		return
 	}
 
+	if len(tags) > 0 {
+		err = app.snippets.SetTags(id, tags)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+	}
+
+	if len(findings) > 0 {
+		app.infoLog.Printf("user %d published snippet %d despite %d possible secrets", app.authenticatedUserID(r), id, len(findings))
+	}
+
 	// Use the Put() method to add a string value ("Sniipet successfully created")
 	// and the corresponding key("flash") to the session data
-	app.sessionManager.Put(r.Context(), "flash", "Snippet successfully created!")
+	if publishAt.IsZero() {
+		app.sessionManager.Put(r.Context(), "flash", "Snippet successfully created!")
+	} else {
+		app.sessionManager.Put(r.Context(), "flash", "Snippet scheduled for "+humanDate(publishAt))
+	}
 
 	// Update the redirect path to use the new clean URL format.
 	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", id), http.StatusSeeOther)
 
 } // end of SnippetCreatePost
 
+// snippetCreateFormat handles the create form's "Format" button. It formats (or just
+// checks) the content and shows the form again, without publishing anything. If the user
+// hasn't picked a language, we use our best guess.
+func (app *application) snippetCreateFormat(w http.ResponseWriter, r *http.Request, form snippetCreateForm) {
+	language := form.Language
+	if language == "" {
+		language = langdetect.Detect(form.Title, form.Content).Language
+	}
+
+	switch {
+	case form.ClientEncrypted:
+		// The browser shouldn't let this happen, as the content would have been encrypted.
+		form.Content = ""
+		form.AddFieldError("content", "Encrypted snippets can't be formatted")
+	case !formatter.Supports(language):
+		form.AddFieldError("content", "Only "+strings.Join(formatter.Languages, ", ")+" can be formatted. Pick the language if we've guessed it wrong")
+	default:
+		formatted, err := formatter.Format(language, form.Content)
+		var syntaxErr *formatter.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			form.AddFieldError("content", fmt.Sprintf("This isn't valid %s. %s", language, syntaxErr))
+		} else if err != nil {
+			app.serverError(w, err)
+			return
+		} else {
+			form.Content = formatted
+			form.Language = language
+		}
+	}
+
+	status := http.StatusOK
+	if !form.Valid() {
+		status = http.StatusUnprocessableEntity
+	}
+
+	data := app.newTemplateData(r)
+	data.Form = form
+	app.render(w, status, "create.tmpl", data)
+}
+
 func (app *application) userSignup(w http.ResponseWriter, r *http.Request) {
 	data := app.newTemplateData(r)
 	data.Form = userSignupForm{}
@@ -207,10 +682,19 @@ func (app *application) userSignupPost(w http.ResponseWriter, r *http.Request) {
 		} else {
 			app.serverError(w, err)
 		}
+		return
+	}
+
+	// Send them a link to verify their email address with. The account exists either way,
+	// so if the email can't be sent we only log it: they can ask for another one once
+	// they've logged in.
+	err = app.sendActivationEmail(form.Email)
+	if err != nil {
+		app.errorLog.Printf("sending verification email: %v", err)
 	}
 
 	// Otherwise add a confirmation flash message to the session confirming that their signup worked
-	app.sessionManager.Put(r.Context(), "flash", "Your signup was succesful. Please log in")
+	app.sessionManager.Put(r.Context(), "flash", "Your signup was succesful. We've emailed you a link to verify your address. Please log in")
 
 	// And redirect the user to the login page.
 	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
@@ -237,6 +721,7 @@ func (app *application) userLoginPost(w http.ResponseWriter, r *http.Request) {
 	// and also check the format of the email address as a UX-nicety (in case the user makes a typo)
 	form.CheckField(validator.NotBlank(form.Email), "email", "This field cannot be blank")
 	form.CheckField(validator.Matches(form.Email, validator.EmailRX), "email", "This field must be a valid email address")
+	form.CheckField(validator.MaxChars(form.Email, 255), "email", "This field cannot be more than 255 characters long")
 	form.CheckField(validator.NotBlank(form.Password), "password", "This field cannot be blank")
 
 	if !form.Valid() {
@@ -246,13 +731,39 @@ func (app *application) userLoginPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Don't even check the password if there have been too many wrong ones lately, for
+	// this account or from this address.
+	ip := clientIP(r)
+
+	until, err := app.loginLockedUntil(form.Email, ip)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	if time.Now().Before(until) {
+		app.loginLocked(w, r, form, until)
+		return
+	}
+
 	// Check whether the credentials are valid. If they'r not, add a generic non-field error message
 	// and re-display the login page.
 	id, err := app.users.Authenticate(form.Email, form.Password)
 	if err != nil {
 		if errors.Is(err, models.ErrInvalidCredentials) {
+			err = app.loginFailed(form.Email, ip)
+			if err != nil {
+				app.serverError(w, err)
+				return
+			}
+
 			form.AddNonFieldError("Email or password is incorrect")
 
+			data := app.newTemplateData(r)
+			data.Form = form
+			app.render(w, http.StatusUnprocessableEntity, "login.tmpl", data)
+		} else if errors.Is(err, models.ErrAccountSuspended) {
+			form.AddNonFieldError("Your account has been suspended")
+
 			data := app.newTemplateData(r)
 			data.Form = form
 			app.render(w, http.StatusUnprocessableEntity, "login.tmpl", data)
@@ -262,6 +773,37 @@ func (app *application) userLoginPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// If they've turned on two-factor authentication, the password is only half of it: they
+	// aren't logged in until they've entered a code too.
+	tf, err := app.twoFactor.Get(id)
+	if errors.Is(err, models.ErrNoKeys) {
+		// Their secret can't be decrypted, so there's no checking a code. Letting them in
+		// on the password alone would make removing the keys a way around two-factor
+		// authentication, so they'll have to wait until the keys are back.
+		app.errorLog.Printf("user %d has two-factor authentication set up, but no encryption keys are loaded", id)
+
+		form.AddNonFieldError("Logging in to this account isn't possible right now. Please try again later.")
+
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, http.StatusServiceUnavailable, "login.tmpl", data)
+		return
+	}
+	if err != nil && !errors.Is(err, models.ErrNoRecord) {
+		app.serverError(w, err)
+		return
+	}
+	if tf != nil && tf.Enabled {
+		app.beginTwoFactorLogin(w, r, id, form.Email)
+		return
+	}
+
+	err = app.loginSucceeded(form.Email)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
 	// Use the RenewToken() method on the current session to change the session ID
 	// It's good practice to generate a new session ID when the authentication state or privilege levels
 	// change for the user (e.g. login and logout operations)
@@ -297,6 +839,395 @@ func (app *application) userLogoutPost(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
 
+func (app *application) snippetNoindexPost(w http.ResponseWriter, r *http.Request) {
+	snippet := app.authorizedSnippet(w, r, models.PermissionOwner)
+	if snippet == nil {
+		return
+	}
+
+	var form snippetNoindexForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = app.snippets.SetNoindex(snippet.ID, form.Noindex)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	if form.Noindex {
+		app.sessionManager.Put(r.Context(), "flash", "Search engines will be asked not to index this snippet")
+	} else {
+		app.sessionManager.Put(r.Context(), "flash", "Search engines may index this snippet")
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", snippet.ID), http.StatusSeeOther)
+}
+
+// snippetStarPost stars a snippet for the current user, or takes their star away. Anyone
+// who can see a snippet can star it.
+func (app *application) snippetStarPost(w http.ResponseWriter, r *http.Request) {
+	snippet := app.authorizedSnippet(w, r, models.PermissionView)
+	if snippet == nil {
+		return
+	}
+
+	var form snippetStarForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = app.snippets.SetStarred(snippet.ID, app.authenticatedUserID(r), form.Starred)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	if form.Starred {
+		app.sessionManager.Put(r.Context(), "flash", "Snippet starred")
+	} else {
+		app.sessionManager.Put(r.Context(), "flash", "Star removed")
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", snippet.ID), http.StatusSeeOther)
+}
+
+// snippetLanguagePost lets the owner correct the language we guessed for their snippet, or
+// set one if we couldn't guess.
+func (app *application) snippetLanguagePost(w http.ResponseWriter, r *http.Request) {
+	snippet := app.authorizedSnippet(w, r, models.PermissionOwner)
+	if snippet == nil {
+		return
+	}
+
+	var form snippetLanguageForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	if form.Language != "" && !validator.PermittedValue(form.Language, langdetect.Languages...) {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = app.snippets.SetLanguage(snippet.ID, form.Language)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Language updated")
+
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", snippet.ID), http.StatusSeeOther)
+}
+
+func (app *application) snippetReportPost(w http.ResponseWriter, r *http.Request) {
+	snippet := app.authorizedSnippet(w, r, models.PermissionView)
+	if snippet == nil {
+		return
+	}
+
+	var form snippetReportForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.Reason), "reason", "This field cannot be blank")
+	form.CheckField(validator.MaxChars(form.Reason, 500), "reason", "This field cannot be more than 500 characters long")
+
+	if !form.Valid() {
+		data, err := app.newSnippetTemplateData(w, r, snippet)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+		data.Form = form
+		app.render(w, http.StatusUnprocessableEntity, "view.tmpl", data)
+		return
+	}
+
+	err = app.reports.Insert(snippet.ID, app.authenticatedUserID(r), form.Reason)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Thanks, a moderator will review this snippet.")
+
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", snippet.ID), http.StatusSeeOther)
+}
+
+func (app *application) moderationQueue(w http.ResponseWriter, r *http.Request) {
+	reports, err := app.reports.Open()
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	actions, err := app.reports.RecentActions()
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Reports = reports
+	data.Actions = actions
+
+	app.render(w, http.StatusOK, "moderation.tmpl", data)
+}
+
+func (app *application) moderationResolvePost(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return
+	}
+
+	var form moderationForm
+
+	err = app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	moderatorID := app.authenticatedUserID(r)
+
+	err = app.reports.Resolve(id, moderatorID, form.Action)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else if errors.Is(err, models.ErrInvalidAction) {
+			app.clientError(w, http.StatusBadRequest)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	// The decision is stored in moderation_actions, but leave a trail in the log too.
+	app.infoLog.Printf("moderator %d resolved report %d: %s", moderatorID, id, form.Action)
+
+	app.sessionManager.Put(r.Context(), "flash", "Report resolved")
+
+	http.Redirect(w, r, "/admin/reports", http.StatusSeeOther)
+}
+
+// accountView shows the logged in user who they are.
+func (app *application) accountView(w http.ResponseWriter, r *http.Request) {
+	user, err := app.users.Get(app.authenticatedUserID(r))
+	if err != nil {
+		// requireAuthentication has already checked the user exists, so if they don't now
+		// they've been deleted in the meantime: send them to log in again.
+		if errors.Is(err, models.ErrNoRecord) {
+			http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	tf, err := app.twoFactor.Get(user.ID)
+	if err != nil && !errors.Is(err, models.ErrNoRecord) {
+		app.serverError(w, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.User = user
+	data.TwoFactor = tf
+
+	app.render(w, http.StatusOK, "account.tmpl", data)
+}
+
+func (app *application) accountPasswordUpdate(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	data.Form = accountPasswordUpdateForm{}
+
+	app.render(w, http.StatusOK, "password.tmpl", data)
+}
+
+func (app *application) accountPasswordUpdatePost(w http.ResponseWriter, r *http.Request) {
+	var form accountPasswordUpdateForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	// The same rules as signup, plus the confirmation has to match.
+	form.CheckField(validator.NotBlank(form.CurrentPassword), "currentPassword", "This field cannot be blank")
+	form.CheckField(validator.NotBlank(form.NewPassword), "newPassword", "This field cannot be blank")
+	form.CheckField(validator.MinChars(form.NewPassword, 8), "newPassword", "This field must be at least 8 characters long")
+	form.CheckField(validator.NotBlank(form.NewPasswordConfirmation), "newPasswordConfirmation", "This field cannot be blank")
+	form.CheckField(form.NewPassword == form.NewPasswordConfirmation, "newPasswordConfirmation", "Passwords do not match")
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, http.StatusUnprocessableEntity, "password.tmpl", data)
+		return
+	}
+
+	userID := app.authenticatedUserID(r)
+
+	err = app.users.PasswordUpdate(userID, form.CurrentPassword, form.NewPassword)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidCredentials) {
+			form.AddFieldError("currentPassword", "Current password is incorrect")
+
+			data := app.newTemplateData(r)
+			data.Form = form
+			app.render(w, http.StatusUnprocessableEntity, "password.tmpl", data)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	// As with logging in, a change to what the session proves calls for a new session token.
+	err = app.sessionManager.RenewToken(r.Context())
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	// Anybody else logged in as this user (say, whoever made them change their password)
+	// is logged out. This session's new token isn't in the store until the response is
+	// written, so it's safe from this.
+	err = app.destroyUserSessions(r.Context(), userID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Your password has been updated! Any other devices you were logged in on have been logged out.")
+
+	http.Redirect(w, r, "/account/view", http.StatusSeeOther)
+}
+
+// exportManifestEntry describes one snippet in the manifest.json of an account export.
+type exportManifestEntry struct {
+	ID      int       `json:"id"`
+	File    string    `json:"file"`
+	Title   string    `json:"title"`
+	Created time.Time `json:"created"`
+	Expires time.Time `json:"expires"`
+
+	// The file holds ciphertext, which only the link the snippet was shared with can open.
+	ClientEncrypted bool `json:"client_encrypted,omitempty"`
+
+	Tags []string `json:"tags"`
+}
+
+func (app *application) accountExport(w http.ResponseWriter, r *http.Request) {
+	// The archive is written straight to the http.ResponseWriter as each snippet is read from
+	// the database, so nothing but the (small) manifest entries is held in memory. The flip side
+	// is that once the first byte has gone out we can no longer send a 500 response, so errors
+	// after that point are only logged and the client ends up with a truncated download.
+	// Nothing goes out before the first snippet has been read, though (and the zip writer
+	// buffers the first few KB), so failing to query the database still gets a proper 500.
+	out := &exportWriter{w: w}
+	zw := zip.NewWriter(out)
+	manifest := []exportManifestEntry{}
+
+	fail := func(err error) {
+		if out.started {
+			app.errorLog.Output(3, fmt.Sprintf("account export: %s", err))
+		} else {
+			app.serverError(w, err)
+		}
+	}
+
+	err := app.snippets.EachByUser(app.authenticatedUserID(r), func(s *models.Snippet) error {
+		name := fmt.Sprintf("snippets/%d-%s.txt", s.ID, slugify(s.Title))
+
+		f, err := zw.CreateHeader(&zip.FileHeader{
+			Name:     name,
+			Method:   zip.Deflate,
+			Modified: s.Created,
+		})
+		if err != nil {
+			return err
+		}
+
+		_, err = f.Write([]byte(s.Content))
+		if err != nil {
+			return err
+		}
+
+		manifest = append(manifest, exportManifestEntry{
+			ID:      s.ID,
+			File:    name,
+			Title:   s.Title,
+			Created: s.Created,
+			Expires: s.Expires,
+
+			ClientEncrypted: s.ClientEncrypted,
+
+			Tags: s.Tags,
+		})
+		return nil
+	})
+	if err != nil {
+		fail(err)
+		return
+	}
+
+	f, err := zw.Create("manifest.json")
+	if err != nil {
+		fail(err)
+		return
+	}
+
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	err = enc.Encode(manifest)
+	if err != nil {
+		fail(err)
+		return
+	}
+
+	// Close() writes the zip central directory, without it the archive can't be opened.
+	err = zw.Close()
+	if err != nil {
+		fail(err)
+	}
+}
+
+// exportWriter sets the headers for a zip download when the first byte of the archive is
+// written, and keeps track of whether that has happened yet.
+type exportWriter struct {
+	w       http.ResponseWriter
+	started bool
+}
+
+func (e *exportWriter) Write(p []byte) (int, error) {
+	if !e.started {
+		e.w.Header().Set("Content-Type", "application/zip")
+		e.w.Header().Set("Content-Disposition", `attachment; filename="snippetbox-export.zip"`)
+		e.started = true
+	}
+	return e.w.Write(p)
+}
+
 func ping(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte("OK"))
 }
@@ -2,11 +2,19 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
 	"runtime/debug"
+	"sort"
+	"strings"
 	"time"
+	"unicode"
+
+	"snippetbox/internal/langdetect"
+	"snippetbox/internal/models"
+	"snippetbox/internal/validator"
 
 	"github.com/go-playground/form/v4"
 	"github.com/justinas/nosurf"
@@ -74,7 +82,12 @@ func (app *application) newTemplateData(r *http.Request) *templateData {
 		CurrentYear:     time.Now().Year(),
 		Flash:           app.sessionManager.PopString(r.Context(), "flash"),
 		IsAuthenticated: app.isAuthenticated(r),
+		IsAdmin:         app.isAdmin(r),
+		UserID:          app.authenticatedUserID(r),
 		CSRFToken:       nosurf.Token(r),
+		Languages:       langdetect.Languages,
+		Orgs:            app.memberships(r),
+		CurrentOrg:      app.currentOrg(r),
 	}
 }
 
@@ -118,3 +131,192 @@ func (app *application) isAuthenticated(r *http.Request) bool {
 
 	return isAuthenticted
 }
+
+// Return true if the current request is from a moderator, otherwise return false
+func (app *application) isAdmin(r *http.Request) bool {
+	isAdmin, ok := r.Context().Value(isAdminContextKey).(bool)
+	if !ok {
+		return false
+	}
+
+	return isAdmin
+}
+
+// authorize reports whether the current user has the given permission on a snippet. It's
+// the one place access to snippets is decided, so every handler which shows or changes a
+// snippet should come through here (usually by way of authorizedSnippet).
+//
+// Owners can do anything. Anyone can view a published snippet, unless it belongs to an
+// organization, in which case its members can view it, and the organization's owners and
+// admins can edit and share it too. Beyond that it's down to what the owner has shared:
+// edit includes view, and nobody else is ever treated as the owner, so only they (and
+// their organization's admins) can change who the snippet is shared with.
+func (app *application) authorize(r *http.Request, s *models.Snippet, permission string) (bool, error) {
+	userID := app.authenticatedUserID(r)
+
+	if userID != 0 && s.UserID == userID {
+		return true, nil
+	}
+
+	if permission == models.PermissionView && s.Public() {
+		return true, nil
+	}
+
+	if userID == 0 {
+		return false, nil
+	}
+
+	if s.OrgID != 0 && s.Published() {
+		switch app.orgRole(r, s.OrgID) {
+		case models.RoleOwner, models.RoleAdmin:
+			return true, nil
+		case models.RoleMember:
+			if permission == models.PermissionView {
+				return true, nil
+			}
+		}
+	}
+
+	if permission == models.PermissionOwner {
+		return false, nil
+	}
+
+	granted, err := app.acls.Permission(s.ID, userID)
+	if err != nil {
+		return false, err
+	}
+
+	switch granted {
+	case models.PermissionEdit:
+		return true, nil
+	case models.PermissionView:
+		return permission == models.PermissionView, nil
+	default:
+		return false, nil
+	}
+}
+
+// memberships returns the organizations the current user belongs to, as loaded by the
+// authenticate middleware.
+func (app *application) memberships(r *http.Request) []*models.Membership {
+	memberships, ok := r.Context().Value(membershipsContextKey).([]*models.Membership)
+	if !ok {
+		return nil
+	}
+
+	return memberships
+}
+
+// orgRole returns the current user's role in an organization, or "" if they aren't in it.
+func (app *application) orgRole(r *http.Request, orgID int) string {
+	for _, m := range app.memberships(r) {
+		if m.OrgID == orgID {
+			return m.Role
+		}
+	}
+	return ""
+}
+
+// currentOrg returns the organization picked with the nav bar's switcher, or nil if the
+// user is working on their personal snippets. If they've left the organization since they
+// picked it, they're back to personal.
+func (app *application) currentOrg(r *http.Request) *models.Membership {
+	id := app.sessionManager.GetInt(r.Context(), "currentOrgID")
+	for _, m := range app.memberships(r) {
+		if m.OrgID == id {
+			return m
+		}
+	}
+	return nil
+}
+
+// destroyUserSessions deletes every session in the store which is logged in as the given
+// user. The store has no index by user, so this reads every session there is. That's fine
+// for something as rare as a password change, but it's not something to do on every
+// request.
+func (app *application) destroyUserSessions(ctx context.Context, userID int) error {
+	return app.sessionManager.Iterate(ctx, func(ctx context.Context) error {
+		if app.sessionManager.GetInt(ctx, "authenticatedUserID") != userID {
+			return nil
+		}
+		return app.sessionManager.Destroy(ctx)
+	})
+}
+
+// Return the ID of the current user from the session, or 0 if nobody is logged in.
+func (app *application) authenticatedUserID(r *http.Request) int {
+	return app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+}
+
+// background runs fn in its own goroutine, so that a handler can respond without waiting
+// for it. A panic is logged rather than taking the server down, since recoverPanic only
+// protects the goroutines serving requests.
+func (app *application) background(fn func()) {
+	app.wg.Add(1)
+
+	go func() {
+		defer app.wg.Done()
+
+		defer func() {
+			if err := recover(); err != nil {
+				app.errorLog.Output(2, fmt.Sprintf("background task: %s", err))
+			}
+		}()
+
+		fn()
+	}()
+}
+
+// slugify turns a snippet title into something safe to use as a file name, keeping ASCII
+// letters and digits and collapsing everything else into single dashes.
+func slugify(title string) string {
+	var b strings.Builder
+
+	dash := false
+	for _, c := range strings.ToLower(title) {
+		if (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') {
+			b.WriteRune(c)
+			dash = false
+		} else if !dash && b.Len() > 0 {
+			b.WriteByte('-')
+			dash = true
+		}
+	}
+
+	slug := strings.TrimSuffix(b.String(), "-")
+	if slug == "" {
+		return "snippet"
+	}
+	return slug
+}
+
+// maxTags is how many tags a snippet can be filed under.
+const maxTags = 5
+
+// parseTags splits what was typed into a tags field on commas and spaces, lowercasing
+// each tag and dropping repeats. It doesn't check the tags are valid: see checkTags().
+func parseTags(s string) []string {
+	tags := []string{}
+	seen := map[string]bool{}
+
+	for _, tag := range strings.FieldsFunc(strings.ToLower(s), func(c rune) bool {
+		return c == ',' || unicode.IsSpace(c)
+	}) {
+		if !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+
+	sort.Strings(tags)
+	return tags
+}
+
+// checkTags adds a "tags" field error to the form if there are too many tags or any of
+// them isn't in the format validator.TagRX allows.
+func checkTags(v *validator.Validator, tags []string) {
+	v.CheckField(len(tags) <= maxTags, "tags", fmt.Sprintf("This field cannot have more than %d tags", maxTags))
+	for _, tag := range tags {
+		v.CheckField(validator.Matches(tag, validator.TagRX), "tags", "Tags can only contain letters, digits and dashes, and must be 32 characters or fewer")
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+// snippetLine is one numbered line of a snippet, as rendered on the view page.
+type snippetLine struct {
+	Number      int
+	Text        string
+	Highlighted bool
+}
+
+// splitLines breaks snippet content into lines. A single trailing newline doesn't start
+// another (empty) line, which matches how editors number lines.
+func splitLines(content string) []string {
+	return strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+}
+
+// parseLineRange parses the value of a ?lines= parameter, either a single line ("12") or
+// an inclusive range ("12-20"), for content with max lines. The end of the range is clamped
+// to max. ok is false if the value is malformed or starts past the last line.
+func parseLineRange(s string, max int) (start, end int, ok bool) {
+	from, to, found := strings.Cut(s, "-")
+
+	start, err := strconv.Atoi(from)
+	if err != nil || start < 1 || start > max {
+		return 0, 0, false
+	}
+
+	end = start
+	if found {
+		end, err = strconv.Atoi(to)
+		if err != nil || end < start {
+			return 0, 0, false
+		}
+	}
+
+	if end > max {
+		end = max
+	}
+
+	return start, end, true
+}
+
+// numberLines returns the lines of content ready for the view template, with the lines in
+// the ?lines= range (if any) flagged for highlighting. An unusable range is ignored rather
+// than treated as an error, the page is still worth showing.
+func numberLines(content, lineRange string) []snippetLine {
+	texts := splitLines(content)
+
+	start, end, ok := parseLineRange(lineRange, len(texts))
+
+	lines := make([]snippetLine, len(texts))
+	for i, text := range texts {
+		n := i + 1
+		lines[i] = snippetLine{
+			Number:      n,
+			Text:        text,
+			Highlighted: ok && n >= start && n <= end,
+		}
+	}
+
+	return lines
+}
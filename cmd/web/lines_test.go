@@ -0,0 +1,36 @@
+package main
+
+import (
+	"snippetbox/internal/assert"
+	"testing"
+)
+
+func TestParseLineRange(t *testing.T) {
+	tests := []struct {
+		name      string
+		value     string
+		max       int
+		wantStart int
+		wantEnd   int
+		wantOK    bool
+	}{
+		{name: "Single line", value: "12", max: 30, wantStart: 12, wantEnd: 12, wantOK: true},
+		{name: "Range", value: "12-20", max: 30, wantStart: 12, wantEnd: 20, wantOK: true},
+		{name: "Clamped", value: "12-200", max: 30, wantStart: 12, wantEnd: 30, wantOK: true},
+		{name: "Past the end", value: "31", max: 30},
+		{name: "Backwards", value: "20-12", max: 30},
+		{name: "Zero", value: "0", max: 30},
+		{name: "Empty", value: "", max: 30},
+		{name: "Junk", value: "L12", max: 30},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, end, ok := parseLineRange(tt.value, tt.max)
+
+			assert.Equal(t, ok, tt.wantOK)
+			assert.Equal(t, start, tt.wantStart)
+			assert.Equal(t, end, tt.wantEnd)
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"snippetbox/internal/models"
+)
+
+// A lockoutPolicy says how long logins are refused for after a number of failures. The
+// first few failures are free, then each one doubles the wait, up to max. Failures are
+// forgotten once there haven't been any for window.
+type lockoutPolicy struct {
+	freeAttempts int
+	base         time.Duration
+	max          time.Duration
+	window       time.Duration
+}
+
+// Each account gets a handful of tries. An IP address gets more, since lots of people can
+// share one (an office, or a phone network). Note that behind a reverse proxy every
+// request seems to come from the proxy, so the IP limit would apply to everyone at once.
+var (
+	accountLockout = lockoutPolicy{freeAttempts: 5, base: 30 * time.Second, max: time.Hour, window: 24 * time.Hour}
+	ipLockout      = lockoutPolicy{freeAttempts: 20, base: 30 * time.Second, max: time.Hour, window: 24 * time.Hour}
+)
+
+// lockout returns how long to refuse logins for after the given number of failures.
+func (p lockoutPolicy) lockout(failures int) time.Duration {
+	if failures < p.freeAttempts {
+		return 0
+	}
+
+	// Stop doubling well before the shift could overflow.
+	doublings := failures - p.freeAttempts
+	if doublings > 30 {
+		return p.max
+	}
+
+	d := p.base << doublings
+	if d > p.max {
+		return p.max
+	}
+	return d
+}
+
+// A lockoutCheck is one of the counts that can hold up a request: the failures recorded
+// against key in scope, and the policy that says how long they hold it up for.
+type lockoutCheck struct {
+	scope  string
+	key    string
+	policy lockoutPolicy
+}
+
+// lockedUntil returns when all of the checks will next allow a request. It's in the past
+// if they allow one now.
+func (app *application) lockedUntil(checks ...lockoutCheck) (time.Time, error) {
+	var until time.Time
+
+	for _, c := range checks {
+		failures, lastFailure, err := app.loginAttempts.Failures(c.scope, c.key, c.policy.window)
+		if err != nil {
+			return time.Time{}, err
+		}
+
+		if t := lastFailure.Add(c.policy.lockout(failures)); t.After(until) {
+			until = t
+		}
+	}
+
+	return until, nil
+}
+
+// loginLockedUntil returns when logins for this email address from this IP address will
+// be allowed again. It's in the past if they're allowed now.
+func (app *application) loginLockedUntil(email, ip string) (time.Time, error) {
+	return app.lockedUntil(
+		lockoutCheck{models.AttemptScopeAccount, accountKey(email), accountLockout},
+		lockoutCheck{models.AttemptScopeIP, ip, ipLockout},
+	)
+}
+
+// loginFailed records a wrong password, or a wrong code from an authenticator app.
+func (app *application) loginFailed(email, ip string) error {
+	err := app.loginAttempts.Fail(models.AttemptScopeAccount, accountKey(email), accountLockout.window)
+	if err != nil {
+		return err
+	}
+
+	return app.loginAttempts.Fail(models.AttemptScopeIP, ip, ipLockout.window)
+}
+
+// loginSucceeded clears the account's failures. The IP address's are left alone: otherwise
+// someone with an account of their own could log into it between guesses at other
+// people's passwords.
+func (app *application) loginSucceeded(email string) error {
+	return app.loginAttempts.Reset(models.AttemptScopeAccount, accountKey(email))
+}
+
+// loginLocked re-displays the login form for someone who has to wait before trying again.
+// The message is the same whether or not the email address belongs to anyone, since
+// failures are counted for any address typed in.
+func (app *application) loginLocked(w http.ResponseWriter, r *http.Request, form userLoginForm, until time.Time) {
+	form.AddNonFieldError("Too many failed login attempts. Please wait a while and try again.")
+
+	data := app.newTemplateData(r)
+	data.Form = form
+
+	w.Header().Set("Retry-After", fmt.Sprint(int(time.Until(until).Seconds())+1))
+	app.render(w, http.StatusTooManyRequests, "login.tmpl", data)
+}
+
+// accountKey is what failures are counted against for an email address. Email addresses
+// aren't case sensitive to MySQL, so they aren't here either.
+func accountKey(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// clientIP returns the IP address a request came from, without the port.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
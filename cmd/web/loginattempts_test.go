@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"snippetbox/internal/assert"
+	"snippetbox/internal/models/mocks"
+)
+
+func TestLockoutPolicy(t *testing.T) {
+	p := lockoutPolicy{freeAttempts: 5, base: 30 * time.Second, max: time.Hour, window: 24 * time.Hour}
+
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, 0},
+		{4, 0},
+		{5, 30 * time.Second},
+		{6, time.Minute},
+		{8, 4 * time.Minute},
+		{12, time.Hour},
+		{1000, time.Hour},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.failures), func(t *testing.T) {
+			assert.Equal(t, p.lockout(tt.failures), tt.want)
+		})
+	}
+}
+
+// tryLogin posts the login form and returns the response status and body.
+func (ts *testServer) tryLogin(t *testing.T, email, password string) (int, http.Header, string) {
+	_, _, body := ts.get(t, "/user/login")
+
+	form := url.Values{}
+	form.Add("email", email)
+	form.Add("password", password)
+	form.Add("csrf_token", extractCSRFToken(t, body))
+
+	return ts.postForm(t, "/user/login", form)
+}
+
+func TestLoginAccountLockout(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	// Registered or not, an address is locked out in exactly the same way.
+	for _, email := range []string{"alice@example.com", "nobody@example.com"} {
+		t.Run(email, func(t *testing.T) {
+			for i := 0; i < accountLockout.freeAttempts; i++ {
+				code, _, body := ts.tryLogin(t, email, "wrongPa$$word")
+				assert.Equal(t, code, http.StatusUnprocessableEntity)
+				assert.Equal(t, strings.Contains(body, "Email or password is incorrect"), true)
+			}
+
+			// Even the right password is turned away now.
+			code, headers, body := ts.tryLogin(t, email, "pa$$word")
+			assert.Equal(t, code, http.StatusTooManyRequests)
+			assert.Equal(t, headers.Get("Retry-After"), "30")
+			assert.Equal(t, strings.Contains(body, "Too many failed login attempts"), true)
+		})
+	}
+
+	// Other accounts aren't affected. Email addresses aren't case sensitive.
+	code, _, _ := ts.tryLogin(t, "bob@example.com", "pa$$word")
+	assert.Equal(t, code, http.StatusSeeOther)
+
+	code, _, _ = ts.tryLogin(t, "Alice@Example.com", "pa$$word")
+	assert.Equal(t, code, http.StatusTooManyRequests)
+}
+
+func TestLoginLongEmail(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	// Failures are counted by email address, and the database only has room for 255
+	// characters of one, so longer ones are turned away before they get that far.
+	code, _, body := ts.tryLogin(t, strings.Repeat("a", 250)+"@example.com", "pa$$word")
+	assert.Equal(t, code, http.StatusUnprocessableEntity)
+	assert.Equal(t, strings.Contains(body, "This field cannot be more than 255 characters long"), true)
+}
+
+func TestLoginSuccessResetsAccount(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	for round := 0; round < 2; round++ {
+		for i := 0; i < accountLockout.freeAttempts-1; i++ {
+			code, _, _ := ts.tryLogin(t, "alice@example.com", "wrongPa$$word")
+			assert.Equal(t, code, http.StatusUnprocessableEntity)
+		}
+
+		code, _, _ := ts.tryLogin(t, "alice@example.com", "pa$$word")
+		assert.Equal(t, code, http.StatusSeeOther)
+	}
+}
+
+func TestLoginIPLockout(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	// One wrong password each for lots of accounts still adds up.
+	for i := 0; i < ipLockout.freeAttempts; i++ {
+		code, _, _ := ts.tryLogin(t, fmt.Sprintf("user%d@example.com", i), "pa$$word")
+		assert.Equal(t, code, http.StatusUnprocessableEntity)
+	}
+
+	code, _, body := ts.tryLogin(t, "bob@example.com", "pa$$word")
+	assert.Equal(t, code, http.StatusTooManyRequests)
+	assert.Equal(t, strings.Contains(body, "Too many failed login attempts"), true)
+}
+
+func TestTwoFactorLoginCountsFailures(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	// Starting the login over doesn't give anyone more guesses at the code.
+	wrong := wrongCode(mocks.MockTOTPSecret)
+	for i := 0; i < accountLockout.freeAttempts; i++ {
+		csrfToken := ts.loginTwoFactor(t)
+		code, _, _ := ts.postForm(t, "/user/login/2fa", url.Values{"code": {wrong}, "csrf_token": {csrfToken}})
+		assert.Equal(t, code, http.StatusUnprocessableEntity)
+	}
+
+	code, _, _ := ts.tryLogin(t, "erin@example.com", "pa$$word")
+	assert.Equal(t, code, http.StatusTooManyRequests)
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"crypto/rand"
 	"crypto/tls"
 	"database/sql"
 	"flag"
@@ -8,6 +9,8 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"strings"
+	"sync"
 	"time"
 
 	// Notice how the import path for our driver is prefixed with an underscore?
@@ -26,7 +29,10 @@ import (
 	// back in chapter 02.01 (Project Setup and Creating a Module) so that the import statement looks like this:
 	// "{your-module-path)/internal/models". If you can't remember what module path you used, you can find it at the
 	// thop of go.mod file: "snippetbox.alexedwards.net/internal/models"
+	"snippetbox/internal/envelope"
+	"snippetbox/internal/mailer"
 	"snippetbox/internal/models"
+	"snippetbox/internal/secrets"
 )
 
 // Define an application struct to hold the application-wide dependencies for the web application
@@ -37,9 +43,21 @@ type application struct {
 	infoLog        *log.Logger
 	snippets       models.SnippetModelInterface // add a snippetsfield to the application struct. This will allow us to make the Snippetmodel object available to our handlers
 	users          models.UserModelInterface
+	reports        models.ReportModelInterface
+	acls           models.ACLModelInterface
+	orgs           models.OrgModelInterface
+	tokens         models.TokenModelInterface
+	twoFactor      models.TwoFactorModelInterface
+	loginAttempts  models.LoginAttemptModelInterface
 	templateCache  map[string]*template.Template // add a templateCache field
 	formDecoder    *form.Decoder                 // add a formDecoder field to hold a pointer to a form.Decoder instance
 	sessionManager *scs.SessionManager           // add a new sessionManager field to the application sruct
+	secretScanner  *secrets.Scanner              // checks new snippets for credentials before they're published
+	mailer         mailer.Mailer                 // sends email, via SMTP or into a directory
+	baseURL        string                        // used to build absolute links, e.g. in emails
+	secretKey      []byte                        // signs links we hand out, see sign()
+	trending       *trendingCache                // the trending page's rankings, refreshed in the background
+	wg             sync.WaitGroup                // counts goroutines started by background()
 }
 
 func main() {
@@ -49,6 +67,19 @@ func main() {
 	// will be stored in the addr variable at runtime.
 	addr := flag.String("addr", ":4000", "HTTP network address")
 	dsn := flag.String("dsn", "web:Pyth0n!sta24@/snippetbox?parseTime=true", "MySQL data source name")
+	baseURL := flag.String("base-url", "https://localhost:4000", "Public URL of the site, used in links sent by email")
+	secret := flag.String("secret", os.Getenv("SNIPPETBOX_SECRET"), "Key for signing links (defaults to $SNIPPETBOX_SECRET)")
+	keysFile := flag.String("keys-file", "", "File of keys for encrypting snippets, one id:base64-key per line (defaults to $SNIPPETBOX_KEYS)")
+
+	smtpHost := flag.String("smtp-host", "localhost", "SMTP server host")
+	smtpPort := flag.Int("smtp-port", 25, "SMTP server port")
+	smtpUsername := flag.String("smtp-username", "", "SMTP username")
+	smtpPassword := flag.String("smtp-password", "", "SMTP password")
+	smtpSender := flag.String("smtp-sender", "Snippetbox <no-reply@snippetbox.localhost>", "From address for outgoing email")
+	mailDir := flag.String("mail-dir", "", "Write outgoing email to this directory instead of sending it")
+
+	reminderWindow := flag.Duration("reminder-window", 7*24*time.Hour, "Remind owners of snippets expiring within this window")
+	reminderInterval := flag.Duration("reminder-interval", time.Hour, "How often to look for snippets to send expiry reminders for")
 
 	// Importantly, we use the flag.Parse() function to parse the command-line flag.
 	// This reads in the command-line flag value and assigns it to the addr variable
@@ -76,6 +107,41 @@ func main() {
 	}
 	defer db.Close()
 
+	// Pick the mail backend. Writing to a directory is handy in development, where there
+	// usually isn't an SMTP server to hand.
+	var m mailer.Mailer = &mailer.SMTPMailer{
+		Host:     *smtpHost,
+		Port:     *smtpPort,
+		Username: *smtpUsername,
+		Password: *smtpPassword,
+		Sender:   *smtpSender,
+	}
+	if *mailDir != "" {
+		m = &mailer.DirMailer{Dir: *mailDir, Sender: *smtpSender}
+	}
+
+	// Without a configured secret, fall back to a random one. Everything still works, but
+	// links signed before a restart will stop being accepted after it.
+	secretKey := []byte(*secret)
+	if len(secretKey) == 0 {
+		infoLog.Print("no -secret set, generating a temporary one")
+		secretKey = make([]byte, 32)
+		_, err = rand.Read(secretKey)
+		if err != nil {
+			errorLog.Fatal(err)
+		}
+	}
+
+	// Load the keys for encrypting snippet content. Unlike the signing secret we can't just
+	// make one up: anything encrypted with it would be unreadable after a restart.
+	keys, err := envelope.LoadKeyring(*keysFile, "SNIPPETBOX_KEYS")
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+	if keys == nil {
+		infoLog.Print("no -keys-file or $SNIPPETBOX_KEYS set, new snippets will be stored unencrypted")
+	}
+
 	// Initialize a new template cache
 	templateCache, err := newTemplateChache()
 	if err != nil {
@@ -100,13 +166,27 @@ func main() {
 	app := &application{
 		errorLog:       errorLog,
 		infoLog:        infoLog,
-		snippets:       &models.SnippetModel{DB: db}, // initialize a models.SnippetModel instance and add it to the application dependencies
+		snippets:       &models.SnippetModel{DB: db, Keys: keys}, // initialize a models.SnippetModel instance and add it to the application dependencies
 		users:          &models.UserModel{DB: db},
+		reports:        &models.ReportModel{DB: db},
+		acls:           &models.ACLModel{DB: db},
+		orgs:           &models.OrgModel{DB: db},
+		tokens:         &models.TokenModel{DB: db},
+		twoFactor:      &models.TwoFactorModel{DB: db, Keys: keys},
+		loginAttempts:  &models.LoginAttemptModel{DB: db},
 		templateCache:  templateCache, // add templateCache to the dependencies
 		formDecoder:    formDecoder,
 		sessionManager: sessionManager,
+		secretScanner:  secrets.NewScanner(secrets.DefaultDetectors()...),
+		mailer:         m,
+		baseURL:        strings.TrimSuffix(*baseURL, "/"),
+		secretKey:      secretKey,
+		trending:       newTrendingCache(),
 	}
 
+	app.scheduleExpiryReminders(*reminderInterval, *reminderWindow)
+	app.scheduleTrendingRefresh(10 * time.Minute)
+
 	// Initializew a tls.Config struct to hold the non-default TLS settings we want the server to use.
 	// In this case, the only thing that we're changing is the curve preferences value, so that only elliptic curver with
 	// assembly implementations are used.
@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"net/url"
+	"strings"
 
 	"github.com/justinas/nosurf"
 )
@@ -25,12 +27,45 @@ func secureHeaders(next http.Handler) http.Handler {
 
 func (app *application) logRequest(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		app.infoLog.Printf("%s - %s %s %s", r.RemoteAddr, r.Proto, r.Method, r.URL.RequestURI())
+		app.infoLog.Printf("%s - %s %s %s", r.RemoteAddr, r.Proto, r.Method, redactedURI(r.URL))
 
 		next.ServeHTTP(w, r)
 	})
 }
 
+// Some links we email out carry a secret, either as the last part of the path or as a
+// query parameter. Anyone who can read the log mustn't be able to use them, so they're
+// left out of it.
+var (
+	secretPathPrefixes = []string{"/user/password/reset/", "/user/activate/", "/invite/"}
+	secretQueryParams  = []string{"sig"}
+)
+
+// redactedURI returns the URI of a request as logRequest logs it, with any secrets in it
+// replaced by REDACTED.
+func redactedURI(u *url.URL) string {
+	path := u.Path
+	for _, prefix := range secretPathPrefixes {
+		if strings.HasPrefix(path, prefix) && len(path) > len(prefix) {
+			path = prefix + "REDACTED"
+			break
+		}
+	}
+
+	if u.RawQuery == "" {
+		return path
+	}
+
+	query := u.Query()
+	for _, param := range secretQueryParams {
+		if query.Has(param) {
+			query.Set(param, "REDACTED")
+		}
+	}
+
+	return path + "?" + query.Encode()
+}
+
 func (app *application) recoverPanic(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Create a deferred function (which will always be run in the event of a panic as Go unwinds the stack)
@@ -56,7 +91,7 @@ func (app *application) requireAuthentication(next http.Handler) http.Handler {
 		// return from the middleware chain so that no subsequent handlers in the chain
 		// are executed.
 		if !app.isAuthenticated(r) {
-			http.Redirect(w, r, "/user/loging", http.StatusSeeOther)
+			http.Redirect(w, r, "/user/login", http.StatusSeeOther)
 			return
 		}
 
@@ -69,6 +104,41 @@ func (app *application) requireAuthentication(next http.Handler) http.Handler {
 	})
 }
 
+// requireAdmin must come after requireAuthentication in a chain. Logged in users who
+// aren't moderators get a 403 Forbidden response.
+func (app *application) requireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !app.isAdmin(r) {
+			app.clientError(w, http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireActivation must come after requireAuthentication in a chain. Users who haven't
+// verified their email address yet are sent to their account page, where they can ask
+// for another verification email. Unlike isAdmin, this isn't looked up by authenticate
+// for every request, since only a few routes need it.
+func (app *application) requireActivation(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		activated, err := app.users.Activated(app.authenticatedUserID(r))
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+
+		if !activated {
+			app.sessionManager.Put(r.Context(), "flash", "Please verify your email address before creating snippets. We've sent you a link.")
+			http.Redirect(w, r, "/account/view", http.StatusSeeOther)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
 // Create a NoSurf middleware function which uses a customized CSRF cookie with the Secure, Path and HTTPOnly attributes set
 func noSurf(next http.Handler) http.Handler {
 	csrfHandler := nosurf.New(next)
@@ -86,7 +156,7 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 		// retrieve the authenticatedUserID value from the session using the GetInt() method
 		// This will return the zero value for an int (0) if no "authenticatedUserID" value is in the session
 		// -- in which case call the next handler in the chain as normal and return
-		id := app.sessionManager.GetInt(r.Context(), "authenticatedUserId")
+		id := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
 		if id == 0 {
 			next.ServeHTTP(w, r)
 			return
@@ -105,6 +175,24 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 		// assign it to r.
 		if exists {
 			ctx := context.WithValue(r.Context(), isAuthenticatedContextKey, true)
+
+			// Also record whether the user is a moderator, so that the nav bar and the
+			// requireAdmin middleware don't need to ask the database again.
+			admin, err := app.users.IsAdmin(id)
+			if err != nil {
+				app.serverError(w, err)
+				return
+			}
+			ctx = context.WithValue(ctx, isAdminContextKey, admin)
+
+			// And which organizations they're in, which every page needs for the nav bar.
+			memberships, err := app.orgs.ForUser(id)
+			if err != nil {
+				app.serverError(w, err)
+				return
+			}
+			ctx = context.WithValue(ctx, membershipsContextKey, memberships)
+
 			r = r.WithContext(ctx)
 		}
 
@@ -3,8 +3,11 @@ package main
 import (
 	"bytes"
 	"io"
+	"log"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
 
 	"snippetbox/internal/assert"
@@ -73,3 +76,47 @@ func TestSecureHeaders(t *testing.T) {
 
 	assert.Equal(t, string(body), "OK")
 }
+
+func TestRedactedURI(t *testing.T) {
+	tests := []struct {
+		name string
+		uri  string
+		want string
+	}{
+		{"Nothing secret", "/snippet/view/1?format=true", "/snippet/view/1?format=true"},
+		{"Password reset", "/user/password/reset/s3cret", "/user/password/reset/REDACTED"},
+		{"Activation", "/user/activate/s3cret", "/user/activate/REDACTED"},
+		{"Invitation", "/invite/s3cret", "/invite/REDACTED"},
+		{"Extend signature", "/snippet/extend/1?sig=s3cret", "/snippet/extend/1?sig=REDACTED"},
+		{"Bare prefix", "/user/activate/", "/user/activate/"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := url.ParseRequestURI(tt.uri)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			assert.Equal(t, redactedURI(u), tt.want)
+		})
+	}
+}
+
+func TestLogRequestRedacts(t *testing.T) {
+	app := newTestApplication(t)
+
+	var buf bytes.Buffer
+	app.infoLog = log.New(&buf, "", 0)
+
+	r, err := http.NewRequest(http.MethodGet, "/user/password/reset/s3cret", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	app.logRequest(next).ServeHTTP(httptest.NewRecorder(), r)
+
+	assert.Equal(t, strings.Contains(buf.String(), "GET /user/password/reset/REDACTED"), true)
+	assert.Equal(t, strings.Contains(buf.String(), "s3cret"), false)
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"snippetbox/internal/models"
+)
+
+// openGraph holds what base.tmpl needs for the OpenGraph and Twitter card meta tags, which
+// chat tools and social sites read to unfurl a link.
+type openGraph struct {
+	Title       string
+	Description string
+	URL         string
+	Author      string
+	OEmbedURL   string
+}
+
+// previewLines is how many lines of a snippet go into link previews.
+const previewLines = 3
+
+// newOpenGraph describes a snippet for link previews: its title, author and the first few
+// lines of its content.
+func (app *application) newOpenGraph(s *models.Snippet) *openGraph {
+	link := fmt.Sprintf("%s/snippet/view/%d", app.baseURL, s.ID)
+
+	return &openGraph{
+		Title:       s.Title,
+		Description: preview(s),
+		URL:         link,
+		Author:      s.Author,
+		OEmbedURL:   app.baseURL + "/oembed?format=json&url=" + url.QueryEscape(link),
+	}
+}
+
+// preview returns the first previewLines lines of the snippet, cut down to at most 200
+// characters.
+func preview(s *models.Snippet) string {
+	if s.ClientEncrypted {
+		return encryptedNotice
+	}
+
+	lines := splitLines(s.Content)
+	if len(lines) > previewLines {
+		lines = lines[:previewLines]
+	}
+
+	p := []rune(strings.Join(lines, "\n"))
+	if len(p) > 200 {
+		return string(p[:199]) + "…"
+	}
+	return string(p)
+}
+
+// oEmbedResponse is a "rich" response as described at https://oembed.com.
+type oEmbedResponse struct {
+	Version      string `json:"version"`
+	Type         string `json:"type"`
+	Title        string `json:"title"`
+	AuthorName   string `json:"author_name,omitempty"`
+	ProviderName string `json:"provider_name"`
+	ProviderURL  string `json:"provider_url"`
+	CacheAge     int    `json:"cache_age"`
+	HTML         string `json:"html"`
+	Width        int    `json:"width"`
+	Height       int    `json:"height"`
+}
+
+// The embed is plain HTML rather than an iframe: our X-Frame-Options header stops the
+// site being framed, and consumers sanitise the markup anyway.
+var oEmbedHTML = template.Must(template.New("oembed").Parse(
+	`<blockquote class="snippetbox"><pre><code>{{.Content}}</code></pre>` +
+		`<p><a href="{{.URL}}">{{.Title}}</a> on Snippetbox</p></blockquote>`))
+
+func (app *application) oEmbed(w http.ResponseWriter, r *http.Request) {
+	// JSON is the only format we offer, and the spec asks for a 501 for anything else.
+	if format := r.URL.Query().Get("format"); format != "" && format != "json" {
+		app.clientError(w, http.StatusNotImplemented)
+		return
+	}
+
+	snippet, err := app.snippetFromURL(r.URL.Query().Get("url"))
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	// Embeds are fetched anonymously, so only public snippets can be embedded. Nor can
+	// encrypted ones: the embed would need the key, which we never see.
+	if !snippet.Public() || snippet.ClientEncrypted {
+		app.notFound(w)
+		return
+	}
+
+	link := fmt.Sprintf("%s/snippet/view/%d", app.baseURL, snippet.ID)
+
+	var html strings.Builder
+	err = oEmbedHTML.Execute(&html, map[string]string{
+		"Content": snippet.Content,
+		"URL":     link,
+		"Title":   snippet.Title,
+	})
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	width := 600
+	if n, err := strconv.Atoi(r.URL.Query().Get("maxwidth")); err == nil && n > 0 && n < width {
+		width = n
+	}
+
+	// Roughly a line of text per line of code, plus room for the link underneath.
+	height := 27*len(splitLines(snippet.Content)) + 72
+	if n, err := strconv.Atoi(r.URL.Query().Get("maxheight")); err == nil && n > 0 && n < height {
+		height = n
+	}
+
+	js, err := json.Marshal(oEmbedResponse{
+		Version:      "1.0",
+		Type:         "rich",
+		Title:        snippet.Title,
+		AuthorName:   snippet.Author,
+		ProviderName: "Snippetbox",
+		ProviderURL:  app.baseURL + "/",
+		CacheAge:     3600,
+		HTML:         html.String(),
+		Width:        width,
+		Height:       height,
+	})
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(js)
+}
+
+// snippetFromURL looks up the snippet that one of our own links points to, either
+// /snippet/view/:id or /s/:alias. Anything else gives ErrNoRecord.
+func (app *application) snippetFromURL(rawURL string) (*models.Snippet, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || !strings.HasPrefix(rawURL, app.baseURL+"/") {
+		return nil, models.ErrNoRecord
+	}
+
+	if id, ok := strings.CutPrefix(u.Path, "/snippet/view/"); ok {
+		n, err := strconv.Atoi(id)
+		if err != nil || n < 1 {
+			return nil, models.ErrNoRecord
+		}
+		return app.snippets.Get(n)
+	}
+
+	if alias, ok := strings.CutPrefix(u.Path, "/s/"); ok && alias != "" {
+		return app.snippets.GetByAlias(alias)
+	}
+
+	return nil, models.ErrNoRecord
+}
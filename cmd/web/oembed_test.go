@@ -0,0 +1,70 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"snippetbox/internal/assert"
+	"snippetbox/internal/models"
+)
+
+func TestOEmbed(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		url      string
+		format   string
+		wantCode int
+		wantBody string
+	}{
+		{"Snippet link", "https://snippetbox.test/snippet/view/1", "json", http.StatusOK, `"author_name":"Alice"`},
+		{"Alias link", "https://snippetbox.test/s/silent-pond", "", http.StatusOK, `"title":"An old silent pond"`},
+		{"Encrypted snippet", "https://snippetbox.test/snippet/view/4", "json", http.StatusNotFound, ""},
+		{"Scheduled snippet", "https://snippetbox.test/snippet/view/3", "json", http.StatusNotFound, ""},
+		{"Unknown snippet", "https://snippetbox.test/snippet/view/99", "json", http.StatusNotFound, ""},
+		{"Other site", "https://example.com/snippet/view/1", "json", http.StatusNotFound, ""},
+		{"Not a snippet", "https://snippetbox.test/trending", "json", http.StatusNotFound, ""},
+		{"XML", "https://snippetbox.test/snippet/view/1", "xml", http.StatusNotImplemented, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := url.Values{"url": {tt.url}}
+			if tt.format != "" {
+				q.Set("format", tt.format)
+			}
+
+			code, headers, body := ts.get(t, "/oembed?"+q.Encode())
+
+			assert.Equal(t, code, tt.wantCode)
+			if tt.wantCode == http.StatusOK {
+				assert.Equal(t, headers.Get("Content-Type"), "application/json")
+				assert.Equal(t, strings.Contains(body, `"type":"rich"`), true)
+			}
+			assert.Equal(t, strings.Contains(body, tt.wantBody), true)
+		})
+	}
+}
+
+func TestOpenGraphTags(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	_, _, body := ts.get(t, "/snippet/view/1")
+
+	assert.Equal(t, strings.Contains(body, "<meta property='og:title' content='An old silent pond'>"), true)
+	assert.Equal(t, strings.Contains(body, "<meta property='og:description' content='with an old rusted sword in it'>"), true)
+	assert.Equal(t, strings.Contains(body, "<meta property='og:url' content='https://snippetbox.test/snippet/view/1'>"), true)
+	assert.Equal(t, strings.Contains(body, "application/json+oembed"), true)
+}
+
+func TestPreview(t *testing.T) {
+	assert.Equal(t, preview(&models.Snippet{Content: "one\ntwo\nthree\nfour"}), "one\ntwo\nthree")
+	assert.Equal(t, len([]rune(preview(&models.Snippet{Content: strings.Repeat("x", 300)}))), 200)
+}
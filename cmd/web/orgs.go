@@ -0,0 +1,541 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"snippetbox/internal/mailer"
+	"snippetbox/internal/models"
+	"snippetbox/internal/validator"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// invitationLifetime is how long the link in an invitation email works for.
+const invitationLifetime = 7 * 24 * time.Hour
+
+type orgCreateForm struct {
+	Name                string `form:"name"`
+	Slug                string `form:"slug"`
+	validator.Validator `form:"-"`
+}
+
+type orgSwitchForm struct {
+	OrgID               int `form:"org_id"`
+	validator.Validator `form:"-"`
+}
+
+type orgInviteForm struct {
+	Email               string `form:"email"`
+	Role                string `form:"role"`
+	validator.Validator `form:"-"`
+}
+
+type orgMemberForm struct {
+	UserID              int    `form:"user_id"`
+	Role                string `form:"role"`
+	validator.Validator `form:"-"`
+}
+
+// orgList lists the organizations the user is in, with a form to start a new one.
+func (app *application) orgList(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	data.Form = orgCreateForm{}
+
+	app.render(w, http.StatusOK, "orgs.tmpl", data)
+}
+
+func (app *application) orgCreatePost(w http.ResponseWriter, r *http.Request) {
+	var form orgCreateForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.Slug = strings.ToLower(strings.TrimSpace(form.Slug))
+
+	form.CheckField(validator.NotBlank(form.Name), "name", "This field cannot be blank")
+	form.CheckField(validator.MaxChars(form.Name, 100), "name", "This field cannot be more than 100 characters long")
+	form.CheckField(validator.NoControlChars(form.Name), "name", "This field cannot contain line breaks or other control characters")
+	form.CheckField(validator.Matches(form.Slug, validator.AliasRX), "slug", "This field must be 3-64 lowercase letters, digits or dashes")
+
+	var id int
+	if form.Valid() {
+		id, err = app.orgs.Insert(form.Name, form.Slug, app.authenticatedUserID(r))
+		if errors.Is(err, models.ErrDuplicateSlug) {
+			form.AddFieldError("slug", "This name is already taken")
+		} else if err != nil {
+			app.serverError(w, err)
+			return
+		}
+	}
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, http.StatusUnprocessableEntity, "orgs.tmpl", data)
+		return
+	}
+
+	// Switch to the new organization, since the next thing they'll do is use it.
+	app.sessionManager.Put(r.Context(), "currentOrgID", id)
+	app.sessionManager.Put(r.Context(), "flash", "Organization created. Invite some people to join you!")
+
+	http.Redirect(w, r, "/org/"+form.Slug, http.StatusSeeOther)
+}
+
+// orgSwitchPost handles the switcher in the nav bar. It decides where new snippets are
+// posted by default, and takes the user to that organization's page (or home, for
+// personal).
+func (app *application) orgSwitchPost(w http.ResponseWriter, r *http.Request) {
+	var form orgSwitchForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	if form.OrgID == 0 {
+		app.sessionManager.Remove(r.Context(), "currentOrgID")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	for _, m := range app.memberships(r) {
+		if m.OrgID == form.OrgID {
+			app.sessionManager.Put(r.Context(), "currentOrgID", m.OrgID)
+			http.Redirect(w, r, "/org/"+m.Slug, http.StatusSeeOther)
+			return
+		}
+	}
+
+	app.clientError(w, http.StatusBadRequest)
+}
+
+// memberOrg fetches the organization named by the :slug parameter, if the current user is
+// one of its members. Anyone else gets a Not Found, so they can't discover which
+// organizations exist. If anything is wrong it sends the error response itself and
+// returns nil.
+func (app *application) memberOrg(w http.ResponseWriter, r *http.Request) (*models.Org, string) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	org, err := app.orgs.GetBySlug(params.ByName("slug"))
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return nil, ""
+	}
+
+	role := app.orgRole(r, org.ID)
+	if role == "" {
+		app.notFound(w)
+		return nil, ""
+	}
+
+	return org, role
+}
+
+// newOrgTemplateData returns the templateData for an organization's pages, with the
+// member list (and, for the people who manage it, the open invitations).
+func (app *application) newOrgTemplateData(r *http.Request, org *models.Org, role string) (*templateData, error) {
+	data := app.newTemplateData(r)
+	data.Org = org
+	data.OrgRole = role
+	data.Roles = models.Roles
+
+	members, err := app.orgs.Members(org.ID)
+	if err != nil {
+		return nil, err
+	}
+	data.Members = members
+
+	if canManage(role) {
+		data.Invitations, err = app.orgs.Invitations(org.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return data, nil
+}
+
+// orgPageSize is how many snippets are listed on each page of an organization's page.
+const orgPageSize = 50
+
+// orgSearchBatch is how many snippets an organization search reads from the database at
+// a time, and orgSearchLimit how many matches it stops at.
+const (
+	orgSearchBatch = 100
+	orgSearchLimit = 50
+)
+
+// canManage reports whether a role lets a member invite, promote and remove others.
+func canManage(role string) bool {
+	return role == models.RoleOwner || role == models.RoleAdmin
+}
+
+// orgView lists an organization's snippets, newest first.
+func (app *application) orgView(w http.ResponseWriter, r *http.Request) {
+	org, role := app.memberOrg(w, r)
+	if org == nil {
+		return
+	}
+
+	app.renderOrg(w, r, org, role, orgInviteForm{Role: models.RoleMember}, http.StatusOK)
+}
+
+// orgSearch finds the organization's snippets which mention every word of ?q in their
+// title or content. The content may be encrypted in the database, so the search happens
+// here rather than in SQL. There's no index: the snippets are read orgSearchBatch at a
+// time, newest first, until orgSearchLimit of them have matched or there are no more.
+func (app *application) orgSearch(w http.ResponseWriter, r *http.Request) {
+	org, role := app.memberOrg(w, r)
+	if org == nil {
+		return
+	}
+
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+
+	found := []*models.Snippet{}
+	if query != "" {
+		for offset := 0; len(found) < orgSearchLimit; offset += orgSearchBatch {
+			batch, err := app.snippets.ByOrg(org.ID, offset, orgSearchBatch)
+			if err != nil {
+				app.serverError(w, err)
+				return
+			}
+
+			found = append(found, searchSnippets(batch, query)...)
+
+			if len(batch) < orgSearchBatch {
+				break
+			}
+		}
+	}
+
+	data, err := app.newOrgTemplateData(r, org, role)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	data.Query = query
+	data.Truncated = len(found) >= orgSearchLimit
+	if data.Truncated {
+		found = found[:orgSearchLimit]
+	}
+	data.Snippets = found
+
+	app.render(w, http.StatusOK, "orgsearch.tmpl", data)
+}
+
+// searchSnippets returns the snippets which contain every word of the query, ignoring
+// case. Snippets encrypted in the browser are only searched by title.
+func searchSnippets(snippets []*models.Snippet, query string) []*models.Snippet {
+	words := strings.Fields(strings.ToLower(query))
+	if len(words) == 0 {
+		return []*models.Snippet{}
+	}
+
+	found := []*models.Snippet{}
+
+	for _, s := range snippets {
+		text := strings.ToLower(s.Title)
+		if !s.ClientEncrypted {
+			text += "\n" + strings.ToLower(s.Content)
+		}
+
+		match := true
+		for _, w := range words {
+			if !strings.Contains(text, w) {
+				match = false
+				break
+			}
+		}
+		if match {
+			found = append(found, s)
+		}
+	}
+
+	return found
+}
+
+// orgInvitePost emails someone a link to join the organization. Owners and admins can
+// invite people, but only owners can invite new owners.
+func (app *application) orgInvitePost(w http.ResponseWriter, r *http.Request) {
+	org, role := app.memberOrg(w, r)
+	if org == nil {
+		return
+	}
+
+	if !canManage(role) {
+		app.clientError(w, http.StatusForbidden)
+		return
+	}
+
+	var form orgInviteForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.Email), "email", "This field cannot be blank")
+	form.CheckField(validator.Matches(form.Email, validator.EmailRX), "email", "This field must be a valid email address")
+	form.CheckField(validator.PermittedValue(form.Role, models.Roles...), "role", "This field must be owner, admin or member")
+	form.CheckField(form.Role != models.RoleOwner || role == models.RoleOwner, "role", "Only owners can invite other owners")
+
+	if !form.Valid() {
+		app.renderOrg(w, r, org, role, form, http.StatusUnprocessableEntity)
+		return
+	}
+
+	token, err := newToken()
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	expires := time.Now().Add(invitationLifetime)
+
+	err = app.orgs.Invite(org.ID, form.Email, form.Role, token, expires)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	msg := mailer.Message{
+		To:      form.Email,
+		Subject: fmt.Sprintf("You've been invited to join %s on Snippetbox", org.Name),
+		Body: fmt.Sprintf("Hello,\n\n"+
+			"You've been invited to join %s on Snippetbox, as %s %s.\n\n"+
+			"To accept, sign up or log in with this email address and open this link:\n\n%s/invite/%s\n\n"+
+			"The link works until %s. If you weren't expecting this, you can ignore it.\n\n"+
+			"-- Snippetbox\n",
+			org.Name, article(form.Role), form.Role, app.baseURL, token, humanDate(expires)),
+	}
+
+	err = app.mailer.Send(msg)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("Invitation sent to %s", form.Email))
+
+	http.Redirect(w, r, "/org/"+org.Slug, http.StatusSeeOther)
+}
+
+// renderOrg shows an organization's page, with the page of its snippets picked by ?page=.
+// The form is the invitation form, which is shown again with its errors if it needs
+// correcting.
+func (app *application) renderOrg(w http.ResponseWriter, r *http.Request, org *models.Org, role string, form any, status int) {
+	page := 1
+	if r.URL.Query().Has("page") {
+		var err error
+		page, err = strconv.Atoi(r.URL.Query().Get("page"))
+		if err != nil || page < 1 {
+			app.clientError(w, http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Ask for one more than fits on the page, to find out whether there's another page.
+	snippets, err := app.snippets.OrgTitles(org.ID, (page-1)*orgPageSize, orgPageSize+1)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	data, err := app.newOrgTemplateData(r, org, role)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	data.PrevPage = page - 1
+	if len(snippets) > orgPageSize {
+		snippets = snippets[:orgPageSize]
+		data.NextPage = page + 1
+	}
+	data.Snippets = snippets
+	data.Form = form
+
+	app.render(w, status, "org.tmpl", data)
+}
+
+// orgRolePost changes a member's role. Admins can move people between admin and member;
+// only owners can make someone an owner, or change an owner's role.
+func (app *application) orgRolePost(w http.ResponseWriter, r *http.Request) {
+	org, role := app.memberOrg(w, r)
+	if org == nil {
+		return
+	}
+
+	var form orgMemberForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil || form.UserID < 1 || !validator.PermittedValue(form.Role, models.Roles...) {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	current, err := app.orgs.Role(org.ID, form.UserID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	if current == "" {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	if !canManage(role) || (role != models.RoleOwner && (current == models.RoleOwner || form.Role == models.RoleOwner)) {
+		app.clientError(w, http.StatusForbidden)
+		return
+	}
+
+	err = app.orgs.SetRole(org.ID, form.UserID, form.Role)
+	if errors.Is(err, models.ErrLastOwner) {
+		app.sessionManager.Put(r.Context(), "flash", "An organization needs at least one owner. Make someone else an owner first.")
+		http.Redirect(w, r, "/org/"+org.Slug, http.StatusSeeOther)
+		return
+	} else if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Role updated")
+
+	http.Redirect(w, r, "/org/"+org.Slug, http.StatusSeeOther)
+}
+
+// orgRemovePost takes someone out of the organization. Members can remove themselves (to
+// leave); removing anyone else takes the same rights as changing their role.
+func (app *application) orgRemovePost(w http.ResponseWriter, r *http.Request) {
+	org, role := app.memberOrg(w, r)
+	if org == nil {
+		return
+	}
+
+	var form orgMemberForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil || form.UserID < 1 {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	self := form.UserID == app.authenticatedUserID(r)
+
+	if !self {
+		current, err := app.orgs.Role(org.ID, form.UserID)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+		if current == "" {
+			app.clientError(w, http.StatusBadRequest)
+			return
+		}
+
+		if !canManage(role) || (role != models.RoleOwner && current == models.RoleOwner) {
+			app.clientError(w, http.StatusForbidden)
+			return
+		}
+	}
+
+	err = app.orgs.RemoveMember(org.ID, form.UserID)
+	if errors.Is(err, models.ErrLastOwner) {
+		app.sessionManager.Put(r.Context(), "flash", "An organization needs at least one owner. Make someone else an owner first.")
+		http.Redirect(w, r, "/org/"+org.Slug, http.StatusSeeOther)
+		return
+	} else if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	if self {
+		app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("You've left %s", org.Name))
+		http.Redirect(w, r, "/orgs", http.StatusSeeOther)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Member removed")
+
+	http.Redirect(w, r, "/org/"+org.Slug, http.StatusSeeOther)
+}
+
+// invitation shows the page an invitation email links to. It's on the 'dynamic' chain
+// rather than 'protected', so that someone who isn't logged in yet is told to, rather
+// than being sent to the login page and losing the link.
+func (app *application) invitation(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	token := params.ByName("token")
+
+	invitation, err := app.orgs.GetInvitation(token)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Invitation = invitation
+	data.InviteToken = token
+
+	app.render(w, http.StatusOK, "invite.tmpl", data)
+}
+
+func (app *application) invitationPost(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	invitation, err := app.orgs.AcceptInvitation(params.ByName("token"), app.authenticatedUserID(r))
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.sessionManager.Put(r.Context(), "flash", "This invitation has expired, or was sent to a different email address.")
+			http.Redirect(w, r, "/orgs", http.StatusSeeOther)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "currentOrgID", invitation.OrgID)
+	app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("Welcome to %s!", invitation.OrgName))
+
+	http.Redirect(w, r, "/org/"+invitation.OrgSlug, http.StatusSeeOther)
+}
+
+// newToken returns 32 random bytes, base64url encoded, for links we email out.
+func newToken() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// article returns "an" or "a" to go in front of a role.
+func article(role string) string {
+	if role == models.RoleOwner || role == models.RoleAdmin {
+		return "an"
+	}
+	return "a"
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"snippetbox/internal/assert"
+	"snippetbox/internal/models"
+)
+
+func TestOrgView(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	code, headers, _ := ts.get(t, "/org/acme")
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, headers.Get("Location"), "/user/login")
+
+	// Bob is a member, so he sees the snippets but can't invite anyone.
+	ts.loginAs(t, "bob@example.com")
+
+	code, _, body := ts.get(t, "/org/acme")
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, strings.Contains(body, "Deploy checklist"), true)
+	assert.Equal(t, strings.Contains(body, "alice@example.com"), true)
+	assert.Equal(t, strings.Contains(body, "Send invitation"), false)
+
+	// Acme only has one snippet, so there's no second page.
+	assert.Equal(t, strings.Contains(body, "?page=2"), false)
+
+	code, _, body = ts.get(t, "/org/acme?page=2")
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, strings.Contains(body, "Deploy checklist"), false)
+	assert.Equal(t, strings.Contains(body, "There are no more snippets in Acme."), true)
+	assert.Equal(t, strings.Contains(body, "<a href='/org/acme?page=1'>Newer</a>"), true)
+
+	code, _, _ = ts.get(t, "/org/acme?page=0")
+	assert.Equal(t, code, http.StatusBadRequest)
+
+	// Organizations you aren't in might as well not exist.
+	code, _, _ = ts.get(t, "/org/globex")
+	assert.Equal(t, code, http.StatusNotFound)
+}
+
+func TestOrgSnippet(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	// Snippet 5 belongs to Acme, so it isn't public even though it's published.
+	code, _, _ := ts.get(t, "/snippet/view/5")
+	assert.Equal(t, code, http.StatusNotFound)
+
+	code, _, _ = ts.get(t, "/snippet/raw/5")
+	assert.Equal(t, code, http.StatusNotFound)
+
+	code, _, _ = ts.get(t, "/oembed?url="+url.QueryEscape("https://snippetbox.test/snippet/view/5"))
+	assert.Equal(t, code, http.StatusNotFound)
+
+	// Alice didn't write it, but she owns Acme, so she can edit and share it.
+	ts.login(t)
+
+	code, _, body := ts.get(t, "/snippet/view/5")
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, strings.Contains(body, "/snippet/edit/5"), true)
+	assert.Equal(t, strings.Contains(body, "<h3>Sharing</h3>"), true)
+	assert.Equal(t, strings.Contains(body, "og:title"), false)
+}
+
+func TestOrgSnippetMember(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	// Bob is a plain member of Acme: he can read alice's snippet there, but not change it.
+	ts.loginAs(t, "bob@example.com")
+
+	code, _, body := ts.get(t, "/snippet/view/7")
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, strings.Contains(body, "/snippet/edit/7"), false)
+	assert.Equal(t, strings.Contains(body, "<h3>Sharing</h3>"), false)
+	csrfToken := extractCSRFToken(t, body)
+
+	code, _, _ = ts.get(t, "/snippet/raw/7")
+	assert.Equal(t, code, http.StatusOK)
+
+	code, _, _ = ts.get(t, "/snippet/edit/7")
+	assert.Equal(t, code, http.StatusForbidden)
+
+	form := url.Values{}
+	form.Add("title", "Incident runbook")
+	form.Add("content", "Ignore the pager")
+	form.Add("csrf_token", csrfToken)
+
+	code, _, _ = ts.postForm(t, "/snippet/edit/7", form)
+	assert.Equal(t, code, http.StatusForbidden)
+
+	// His own snippets in Acme are still his to edit.
+	code, _, body = ts.get(t, "/snippet/view/5")
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, strings.Contains(body, "/snippet/edit/5"), true)
+}
+
+func TestOrgSearch(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	ts.login(t)
+
+	tests := []struct {
+		name      string
+		query     string
+		wantFound bool
+		wantBody  string
+	}{
+		{"Title", "deploy", true, ""},
+		{"Content", "Migrations", true, ""},
+		{"Every word", "release migrations", true, ""},
+		{"Missing word", "release rollback", false, "None of Acme's snippets mention"},
+		{"Empty", "", false, "Type some words"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := ts.get(t, "/org/acme/search?q="+url.QueryEscape(tt.query))
+
+			assert.Equal(t, code, http.StatusOK)
+			assert.Equal(t, strings.Contains(body, "/snippet/view/5"), tt.wantFound)
+			assert.Equal(t, strings.Contains(body, tt.wantBody), true)
+		})
+	}
+}
+
+func TestOrgSearchWords(t *testing.T) {
+	snippets := []*models.Snippet{
+		{ID: 1, Title: "Nginx config", Content: "server { listen 443; }"},
+		{ID: 2, Title: "Secrets", Content: "v1:NGINX", ClientEncrypted: true},
+	}
+
+	assert.Equal(t, len(searchSnippets(snippets, "nginx")), 1)
+	assert.Equal(t, len(searchSnippets(snippets, "NGINX 443")), 1)
+	assert.Equal(t, len(searchSnippets(snippets, "secrets")), 1)
+	assert.Equal(t, len(searchSnippets(snippets, "   ")), 0)
+}
+
+func TestOrgInvite(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	ts.login(t)
+
+	_, _, body := ts.get(t, "/org/acme")
+	csrfToken := extractCSRFToken(t, body)
+
+	tests := []struct {
+		name     string
+		email    string
+		role     string
+		wantCode int
+		wantBody string
+	}{
+		{"Valid", "carol@example.com", "admin", http.StatusSeeOther, ""},
+		{"Invalid email", "carol", "member", http.StatusUnprocessableEntity, "This field must be a valid email address"},
+		{"Invalid role", "carol@example.com", "boss", http.StatusUnprocessableEntity, "This field must be owner, admin or member"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("email", tt.email)
+			form.Add("role", tt.role)
+			form.Add("csrf_token", csrfToken)
+
+			code, _, body := ts.postForm(t, "/org/acme/invite", form)
+
+			assert.Equal(t, code, tt.wantCode)
+			assert.Equal(t, strings.Contains(body, tt.wantBody), true)
+		})
+	}
+
+	mailer := app.mailer.(*testMailer)
+	assert.Equal(t, len(mailer.messages), 1)
+	assert.Equal(t, mailer.messages[0].To, "carol@example.com")
+	assert.Equal(t, strings.Contains(mailer.messages[0].Body, "as an admin"), true)
+	assert.Equal(t, strings.Contains(mailer.messages[0].Body, "https://snippetbox.test/invite/"), true)
+}
+
+func TestOrgMembers(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	ts.loginAs(t, "bob@example.com")
+
+	_, _, body := ts.get(t, "/org/acme")
+	csrfToken := extractCSRFToken(t, body)
+
+	// Members can't manage anyone but themselves.
+	code, _, _ := ts.postForm(t, "/org/acme/invite", url.Values{"email": {"carol@example.com"}, "role": {"member"}, "csrf_token": {csrfToken}})
+	assert.Equal(t, code, http.StatusForbidden)
+
+	code, _, _ = ts.postForm(t, "/org/acme/role", url.Values{"user_id": {"2"}, "role": {"owner"}, "csrf_token": {csrfToken}})
+	assert.Equal(t, code, http.StatusForbidden)
+
+	code, _, _ = ts.postForm(t, "/org/acme/remove", url.Values{"user_id": {"1"}, "csrf_token": {csrfToken}})
+	assert.Equal(t, code, http.StatusForbidden)
+
+	code, headers, _ := ts.postForm(t, "/org/acme/remove", url.Values{"user_id": {"2"}, "csrf_token": {csrfToken}})
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, headers.Get("Location"), "/orgs")
+}
+
+func TestOrgRole(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	ts.login(t)
+
+	_, _, body := ts.get(t, "/org/acme")
+	csrfToken := extractCSRFToken(t, body)
+
+	code, _, _ := ts.postForm(t, "/org/acme/role", url.Values{"user_id": {"2"}, "role": {"admin"}, "csrf_token": {csrfToken}})
+	assert.Equal(t, code, http.StatusSeeOther)
+
+	// Alice is Acme's only owner, so she can't step down.
+	code, _, _ = ts.postForm(t, "/org/acme/role", url.Values{"user_id": {"1"}, "role": {"member"}, "csrf_token": {csrfToken}})
+	assert.Equal(t, code, http.StatusSeeOther)
+
+	_, _, body = ts.get(t, "/org/acme")
+	assert.Equal(t, strings.Contains(body, "An organization needs at least one owner"), true)
+
+	code, _, _ = ts.postForm(t, "/org/acme/role", url.Values{"user_id": {"3"}, "role": {"admin"}, "csrf_token": {csrfToken}})
+	assert.Equal(t, code, http.StatusBadRequest)
+}
+
+func TestOrgCreateAndSwitch(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	ts.login(t)
+
+	_, _, body := ts.get(t, "/orgs")
+	assert.Equal(t, strings.Contains(body, "/org/acme"), true)
+	csrfToken := extractCSRFToken(t, body)
+
+	code, _, body := ts.postForm(t, "/orgs/create", url.Values{"name": {"Acme"}, "slug": {"acme"}, "csrf_token": {csrfToken}})
+	assert.Equal(t, code, http.StatusUnprocessableEntity)
+	assert.Equal(t, strings.Contains(body, "This name is already taken"), true)
+
+	// The name goes into the subject of invitation emails, so it mustn't be able to add
+	// headers of its own.
+	code, _, body = ts.postForm(t, "/orgs/create", url.Values{"name": {"Initech\r\nBcc: x@y"}, "slug": {"initech"}, "csrf_token": {csrfToken}})
+	assert.Equal(t, code, http.StatusUnprocessableEntity)
+	assert.Equal(t, strings.Contains(body, "This field cannot contain line breaks or other control characters"), true)
+
+	code, headers, _ := ts.postForm(t, "/orgs/create", url.Values{"name": {"Initech"}, "slug": {"Initech"}, "csrf_token": {csrfToken}})
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, headers.Get("Location"), "/org/initech")
+
+	code, headers, _ = ts.postForm(t, "/orgs/switch", url.Values{"org_id": {"1"}, "csrf_token": {csrfToken}})
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, headers.Get("Location"), "/org/acme")
+
+	// New snippets go to the organization picked in the nav bar.
+	_, _, body = ts.get(t, "/snippet/create")
+	assert.Equal(t, strings.Contains(body, "<option value='1' selected>Acme"), true)
+
+	code, _, _ = ts.postForm(t, "/orgs/switch", url.Values{"org_id": {"2"}, "csrf_token": {csrfToken}})
+	assert.Equal(t, code, http.StatusBadRequest)
+
+	form := url.Values{}
+	form.Add("title", "Not mine to post")
+	form.Add("content", "hello")
+	form.Add("expires", "7")
+	form.Add("org_id", "2")
+	form.Add("csrf_token", csrfToken)
+
+	code, _, body = ts.postForm(t, "/snippet/create", form)
+	assert.Equal(t, code, http.StatusUnprocessableEntity)
+	assert.Equal(t, strings.Contains(body, "You can only post to organizations you&#39;re a member of"), true)
+}
+
+func TestInvitation(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	code, _, _ := ts.get(t, "/invite/nonsense")
+	assert.Equal(t, code, http.StatusNotFound)
+
+	code, _, body := ts.get(t, "/invite/globex-invite")
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, strings.Contains(body, "Join Globex"), true)
+	assert.Equal(t, strings.Contains(body, "then open the link from the email again"), true)
+
+	ts.login(t)
+
+	code, _, body = ts.get(t, "/invite/globex-invite")
+	assert.Equal(t, code, http.StatusOK)
+	csrfToken := extractCSRFToken(t, body)
+
+	code, headers, _ := ts.postForm(t, "/invite/globex-invite", url.Values{"csrf_token": {csrfToken}})
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, headers.Get("Location"), "/org/globex")
+
+	code, headers, _ = ts.postForm(t, "/invite/nonsense", url.Values{"csrf_token": {csrfToken}})
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, headers.Get("Location"), "/orgs")
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"snippetbox/internal/mailer"
+	"snippetbox/internal/models"
+	"snippetbox/internal/validator"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// passwordResetLifetime is how long the link in a password reset email works for. It's
+// kept short, since anyone who can read the email can take over the account.
+const passwordResetLifetime = time.Hour
+
+// passwordResetRequested is what we say whether or not we sent an email, so that the form
+// can't be used to find out who has signed up.
+const passwordResetRequested = "If that email address is registered, we've sent it a link to reset your password."
+
+// Reset requests are limited in the same way as failed logins, except that every request
+// counts. An address gets a few, enough for an email that went astray; an IP address gets
+// more, since lots of people can share one.
+var (
+	resetEmailLimit = lockoutPolicy{freeAttempts: 3, base: 15 * time.Minute, max: 24 * time.Hour, window: 24 * time.Hour}
+	resetIPLimit    = lockoutPolicy{freeAttempts: 10, base: 5 * time.Minute, max: 24 * time.Hour, window: 24 * time.Hour}
+)
+
+type passwordForgotForm struct {
+	Email               string `form:"email"`
+	validator.Validator `form:"-"`
+}
+
+type passwordResetForm struct {
+	NewPassword             string `form:"newPassword"`
+	NewPasswordConfirmation string `form:"newPasswordConfirmation"`
+	validator.Validator     `form:"-"`
+}
+
+func (app *application) passwordForgot(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	data.Form = passwordForgotForm{}
+
+	app.render(w, http.StatusOK, "forgot.tmpl", data)
+}
+
+func (app *application) passwordForgotPost(w http.ResponseWriter, r *http.Request) {
+	var form passwordForgotForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	// It's fine to complain about the format of the address: that says nothing about
+	// whether it belongs to anyone.
+	form.CheckField(validator.NotBlank(form.Email), "email", "This field cannot be blank")
+	form.CheckField(validator.Matches(form.Email, validator.EmailRX), "email", "This field must be a valid email address")
+	form.CheckField(validator.MaxChars(form.Email, 255), "email", "This field cannot be more than 255 characters long")
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, http.StatusUnprocessableEntity, "forgot.tmpl", data)
+		return
+	}
+
+	// Requests for unregistered addresses count too, so that the limit is no clue either.
+	email, ip := accountKey(form.Email), clientIP(r)
+
+	until, err := app.lockedUntil(
+		lockoutCheck{models.AttemptScopeResetEmail, email, resetEmailLimit},
+		lockoutCheck{models.AttemptScopeResetIP, ip, resetIPLimit},
+	)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	if time.Now().Before(until) {
+		form.AddNonFieldError("Too many password reset requests. Please wait a while and try again.")
+
+		data := app.newTemplateData(r)
+		data.Form = form
+
+		w.Header().Set("Retry-After", fmt.Sprint(int(time.Until(until).Seconds())+1))
+		app.render(w, http.StatusTooManyRequests, "forgot.tmpl", data)
+		return
+	}
+
+	err = app.loginAttempts.Fail(models.AttemptScopeResetEmail, email, resetEmailLimit.window)
+	if err == nil {
+		err = app.loginAttempts.Fail(models.AttemptScopeResetIP, ip, resetIPLimit.window)
+	}
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	token, err := newToken()
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	expires := time.Now().Add(passwordResetLifetime)
+
+	// From here on, everything ends the same way, so the response is no clue to whether the
+	// address is registered. Looking the address up and sending the mail happen after
+	// responding, since otherwise registered addresses would take noticeably longer to
+	// answer for. Failures are logged rather than shown for the same reason.
+	app.background(func() {
+		err := app.tokens.Insert(form.Email, models.ScopePasswordReset, token, expires)
+		if err != nil {
+			if !errors.Is(err, models.ErrNoRecord) {
+				app.errorLog.Printf("creating password reset token: %v", err)
+			}
+			return
+		}
+
+		msg := mailer.Message{
+			To:      form.Email,
+			Subject: "Reset your Snippetbox password",
+			Body: fmt.Sprintf("Hello,\n\n"+
+				"Somebody, hopefully you, asked to reset the password for your Snippetbox account. To pick a new one, open this link:\n\n%s/user/password/reset/%s\n\n"+
+				"The link works once, until %s. If you didn't ask for this, you can ignore it and your password will stay as it is.\n\n"+
+				"-- Snippetbox\n",
+				app.baseURL, token, humanDate(expires)),
+		}
+
+		err = app.mailer.Send(msg)
+		if err != nil {
+			app.errorLog.Printf("sending password reset email: %v", err)
+		}
+	})
+
+	app.sessionManager.Put(r.Context(), "flash", passwordResetRequested)
+
+	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+}
+
+func (app *application) passwordReset(w http.ResponseWriter, r *http.Request) {
+	token := httprouter.ParamsFromContext(r.Context()).ByName("token")
+
+	// Check the link before asking for a new password, rather than after they've typed it.
+	_, err := app.tokens.UserID(token, models.ScopePasswordReset)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.invalidResetLink(w, r)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Form = passwordResetForm{}
+	data.ResetToken = token
+
+	app.render(w, http.StatusOK, "reset.tmpl", data)
+}
+
+func (app *application) passwordResetPost(w http.ResponseWriter, r *http.Request) {
+	token := httprouter.ParamsFromContext(r.Context()).ByName("token")
+
+	var form passwordResetForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.NewPassword), "newPassword", "This field cannot be blank")
+	form.CheckField(validator.MinChars(form.NewPassword, 8), "newPassword", "This field must be at least 8 characters long")
+	form.CheckField(validator.NotBlank(form.NewPasswordConfirmation), "newPasswordConfirmation", "This field cannot be blank")
+	form.CheckField(form.NewPassword == form.NewPasswordConfirmation, "newPasswordConfirmation", "Passwords do not match")
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		data.ResetToken = token
+		app.render(w, http.StatusUnprocessableEntity, "reset.tmpl", data)
+		return
+	}
+
+	// Use the token up before changing anything, so that two requests racing each other
+	// can't both get through with it.
+	userID, err := app.tokens.Consume(token, models.ScopePasswordReset)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.invalidResetLink(w, r)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	err = app.users.PasswordSet(userID, form.NewPassword)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	// Whoever knew the old password is logged out, wherever they are.
+	err = app.destroyUserSessions(r.Context(), userID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Your password has been reset. Please log in with your new password.")
+
+	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+}
+
+// invalidResetLink sends someone with a used, expired or mistyped reset link back to ask
+// for a new one.
+func (app *application) invalidResetLink(w http.ResponseWriter, r *http.Request) {
+	app.sessionManager.Put(r.Context(), "flash", "That password reset link is invalid or has expired. Please ask for a new one.")
+
+	http.Redirect(w, r, "/user/password/forgot", http.StatusSeeOther)
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"snippetbox/internal/assert"
+)
+
+func TestPasswordForgot(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	_, _, body := ts.get(t, "/user/login")
+	assert.Equal(t, strings.Contains(body, "/user/password/forgot"), true)
+
+	_, _, body = ts.get(t, "/user/password/forgot")
+	csrfToken := extractCSRFToken(t, body)
+
+	tests := []struct {
+		name     string
+		email    string
+		wantCode int
+		wantBody string
+	}{
+		{"Registered", "alice@example.com", http.StatusSeeOther, ""},
+		{"Unregistered", "nobody@example.com", http.StatusSeeOther, ""},
+		{"Invalid email", "alice", http.StatusUnprocessableEntity, "This field must be a valid email address"},
+		{"Long email", strings.Repeat("a", 250) + "@example.com", http.StatusUnprocessableEntity, "This field cannot be more than 255 characters long"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("email", tt.email)
+			form.Add("csrf_token", csrfToken)
+
+			code, headers, body := ts.postForm(t, "/user/password/forgot", form)
+
+			assert.Equal(t, code, tt.wantCode)
+			assert.Equal(t, strings.Contains(body, tt.wantBody), true)
+
+			// Registered or not, the response is the same.
+			if code == http.StatusSeeOther {
+				assert.Equal(t, headers.Get("Location"), "/user/login")
+
+				_, _, body = ts.get(t, "/user/login")
+				assert.Equal(t, strings.Contains(body, "we&#39;ve sent it a link to reset your password"), true)
+			}
+		})
+	}
+
+	// The email is sent after the response, so wait for it.
+	app.wg.Wait()
+
+	mailer := app.mailer.(*testMailer)
+	assert.Equal(t, len(mailer.messages), 1)
+	assert.Equal(t, mailer.messages[0].To, "alice@example.com")
+	assert.Equal(t, strings.Contains(mailer.messages[0].Body, "https://snippetbox.test/user/password/reset/"), true)
+}
+
+// requestReset posts the forgotten password form and returns the response.
+func (ts *testServer) requestReset(t *testing.T, email string) (int, http.Header, string) {
+	_, _, body := ts.get(t, "/user/password/forgot")
+
+	form := url.Values{}
+	form.Add("email", email)
+	form.Add("csrf_token", extractCSRFToken(t, body))
+
+	return ts.postForm(t, "/user/password/forgot", form)
+}
+
+func TestPasswordForgotLimit(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	// Registered or not, an address is limited in exactly the same way.
+	for _, email := range []string{"alice@example.com", "nobody@example.com"} {
+		t.Run(email, func(t *testing.T) {
+			for i := 0; i < resetEmailLimit.freeAttempts; i++ {
+				code, _, _ := ts.requestReset(t, email)
+				assert.Equal(t, code, http.StatusSeeOther)
+			}
+
+			code, headers, body := ts.requestReset(t, email)
+			assert.Equal(t, code, http.StatusTooManyRequests)
+			assert.Equal(t, headers.Get("Retry-After"), "900")
+			assert.Equal(t, strings.Contains(body, "Too many password reset requests"), true)
+		})
+	}
+
+	app.wg.Wait()
+	assert.Equal(t, len(app.mailer.(*testMailer).messages), resetEmailLimit.freeAttempts)
+
+	// The requests above count against the IP address as well, so it runs out after a
+	// few more, whichever address they're for.
+	for i := 2 * resetEmailLimit.freeAttempts; i < resetIPLimit.freeAttempts; i++ {
+		code, _, _ := ts.requestReset(t, fmt.Sprintf("user%d@example.com", i))
+		assert.Equal(t, code, http.StatusSeeOther)
+	}
+
+	code, _, body := ts.requestReset(t, "bob@example.com")
+	assert.Equal(t, code, http.StatusTooManyRequests)
+	assert.Equal(t, strings.Contains(body, "Too many password reset requests"), true)
+}
+
+func TestPasswordReset(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	// Somebody else is logged in as alice; resetting the password should throw them out.
+	other := newTestServer(t, app.routes())
+	defer other.Close()
+	other.login(t)
+
+	code, headers, _ := ts.get(t, "/user/password/reset/nonsense")
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, headers.Get("Location"), "/user/password/forgot")
+
+	code, _, body := ts.get(t, "/user/password/reset/alice-reset-token")
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, strings.Contains(body, "<form action='/user/password/reset/alice-reset-token'"), true)
+	csrfToken := extractCSRFToken(t, body)
+
+	tests := []struct {
+		name         string
+		urlPath      string
+		new          string
+		confirmation string
+		wantCode     int
+		wantLocation string
+		wantBody     string
+	}{
+		{"Short", "/user/password/reset/alice-reset-token", "pa$$", "pa$$", http.StatusUnprocessableEntity, "", "This field must be at least 8 characters long"},
+		{"Mismatched", "/user/password/reset/alice-reset-token", "newPa$$word", "newPa$$wurd", http.StatusUnprocessableEntity, "", "Passwords do not match"},
+		{"Invalid token", "/user/password/reset/nonsense", "newPa$$word", "newPa$$word", http.StatusSeeOther, "/user/password/forgot", ""},
+		{"Valid", "/user/password/reset/alice-reset-token", "newPa$$word", "newPa$$word", http.StatusSeeOther, "/user/login", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("newPassword", tt.new)
+			form.Add("newPasswordConfirmation", tt.confirmation)
+			form.Add("csrf_token", csrfToken)
+
+			code, headers, body := ts.postForm(t, tt.urlPath, form)
+
+			assert.Equal(t, code, tt.wantCode)
+			assert.Equal(t, headers.Get("Location"), tt.wantLocation)
+			assert.Equal(t, strings.Contains(body, tt.wantBody), true)
+		})
+	}
+
+	code, headers, _ = other.get(t, "/account/view")
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, headers.Get("Location"), "/user/login")
+}
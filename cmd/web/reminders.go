@@ -0,0 +1,186 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"snippetbox/internal/mailer"
+	"snippetbox/internal/models"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// scheduleExpiryReminders starts a background goroutine which, every interval, emails the
+// owners of snippets that will expire within window. It runs once straight away so a
+// freshly started server doesn't wait a whole interval before the first batch.
+func (app *application) scheduleExpiryReminders(interval, window time.Duration) {
+	go func() {
+		// A panic in a background goroutine would take the whole server down, and
+		// recoverPanic only protects the goroutines serving requests.
+		defer func() {
+			if err := recover(); err != nil {
+				app.errorLog.Output(2, fmt.Sprintf("expiry reminders: %s", err))
+			}
+		}()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			app.sendExpiryReminders(window)
+			<-ticker.C
+		}
+	}()
+}
+
+// sendExpiryReminders sends one reminder email per snippet that is about to expire.
+// A snippet is only marked as reminded once its email has gone out, so a failed send is
+// retried on the next run.
+func (app *application) sendExpiryReminders(window time.Duration) {
+	reminders, err := app.snippets.ExpiringSoon(window)
+	if err != nil {
+		app.errorLog.Output(2, fmt.Sprintf("expiry reminders: %s", err))
+		return
+	}
+
+	for _, e := range reminders {
+		msg := mailer.Message{
+			To:      e.Email,
+			Subject: fmt.Sprintf("Your snippet %q expires soon", e.Title),
+			Body: fmt.Sprintf("Hi %s,\n\n"+
+				"Your snippet %q will be deleted on %s.\n\n"+
+				"To keep it for another year, open this link:\n\n%s\n\n"+
+				"If you don't need it any more, you don't have to do anything.\n\n"+
+				"-- Snippetbox\n",
+				e.Name, e.Title, humanDate(e.Expires), app.extendLink(e.SnippetID, e.Expires)),
+		}
+
+		err = app.mailer.Send(msg)
+		if err != nil {
+			app.errorLog.Output(2, fmt.Sprintf("expiry reminders: snippet %d: %s", e.SnippetID, err))
+			continue
+		}
+
+		err = app.snippets.MarkReminded(e.SnippetID)
+		if err != nil {
+			app.errorLog.Output(2, fmt.Sprintf("expiry reminders: snippet %d: %s", e.SnippetID, err))
+			continue
+		}
+
+		app.infoLog.Printf("sent expiry reminder for snippet %d", e.SnippetID)
+	}
+}
+
+// extendLink returns the absolute URL emailed to a snippet's owner. The signature covers
+// the snippet's current expiry time as well as its ID, so a link stops working as soon as
+// it has been used (because the expiry time has moved on) without us storing anything.
+func (app *application) extendLink(id int, expires time.Time) string {
+	return fmt.Sprintf("%s/snippet/extend/%d?sig=%s", app.baseURL, id, app.sign(extendMessage(id, expires)))
+}
+
+func extendMessage(id int, expires time.Time) string {
+	return "extend:" + strconv.Itoa(id) + ":" + strconv.FormatInt(expires.Unix(), 10)
+}
+
+// sign returns a hex encoded HMAC-SHA256 of message using the application's secret key.
+func (app *application) sign(message string) string {
+	mac := hmac.New(sha256.New, app.secretKey)
+	mac.Write([]byte(message))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// validSignature checks a signature made by sign() in constant time.
+func (app *application) validSignature(message, signature string) bool {
+	sig, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, app.secretKey)
+	mac.Write([]byte(message))
+	return hmac.Equal(sig, mac.Sum(nil))
+}
+
+// extendableSnippet returns the snippet a reminder link is for, if the signature in sig
+// is still good. Otherwise it sends a response itself and returns nil, in the same way as
+// authorizedSnippet().
+func (app *application) extendableSnippet(w http.ResponseWriter, r *http.Request, sig string) *models.Snippet {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return nil
+	}
+
+	snippet, err := app.snippets.Get(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return nil
+	}
+
+	if !app.validSignature(extendMessage(snippet.ID, snippet.Expires), sig) {
+		app.sessionManager.Put(r.Context(), "flash", "That link has expired or has already been used")
+		http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", snippet.ID), http.StatusSeeOther)
+		return nil
+	}
+
+	return snippet
+}
+
+// snippetExtend shows the page the link in a reminder email leads to. Nothing changes until
+// the button on it is pressed, for the same reason as activation(): mail scanners follow
+// links, and a GET request shouldn't change anything anyway.
+func (app *application) snippetExtend(w http.ResponseWriter, r *http.Request) {
+	sig := r.URL.Query().Get("sig")
+
+	snippet := app.extendableSnippet(w, r, sig)
+	if snippet == nil {
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Snippet = snippet
+	data.ExtendSignature = sig
+
+	app.render(w, http.StatusOK, "extend.tmpl", data)
+}
+
+// snippetExtendPost keeps the snippet for another year. It deliberately doesn't require the
+// user to be logged in: the signature proves the link came from us, and the CSRF token that
+// the page came with proves the button was pressed on it.
+func (app *application) snippetExtendPost(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	snippet := app.extendableSnippet(w, r, r.PostForm.Get("sig"))
+	if snippet == nil {
+		return
+	}
+
+	err = app.snippets.Extend(snippet.ID, 365)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Snippet extended for another year")
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", snippet.ID), http.StatusSeeOther)
+}
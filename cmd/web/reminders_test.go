@@ -0,0 +1,112 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"snippetbox/internal/assert"
+)
+
+func TestSendExpiryReminders(t *testing.T) {
+	app := newTestApplication(t)
+
+	app.sendExpiryReminders(7 * 24 * time.Hour)
+
+	m := app.mailer.(*testMailer)
+	assert.Equal(t, len(m.messages), 1)
+	assert.Equal(t, m.messages[0].To, "alice@example.com")
+	assert.Equal(t, strings.Contains(m.messages[0].Body, "https://snippetbox.test/snippet/extend/1?sig="), true)
+}
+
+func TestSnippetExtend(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	// Build the link the reminder email would contain for the mock snippet.
+	app.sendExpiryReminders(7 * 24 * time.Hour)
+	body := app.mailer.(*testMailer).messages[0].Body
+
+	start := strings.Index(body, app.baseURL)
+	link, err := url.Parse(strings.Fields(body[start:])[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sig := link.Query().Get("sig")
+
+	// Following the link only shows a page with a button on it.
+	code, _, body := ts.get(t, link.RequestURI())
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, strings.Contains(body, "<form action='/snippet/extend/1' method='POST'>"), true)
+	assert.Equal(t, strings.Contains(body, "<input type='hidden' name='sig' value='"+sig+"'>"), true)
+
+	csrfToken := extractCSRFToken(t, body)
+
+	t.Run("Bad signature link", func(t *testing.T) {
+		code, headers, _ := ts.get(t, "/snippet/extend/1?sig=00ff")
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, headers.Get("Location"), "/snippet/view/1")
+	})
+
+	tests := []struct {
+		name      string
+		urlPath   string
+		sig       string
+		csrfToken string
+		wantCode  int
+		wantFlash string
+	}{
+		{
+			name:      "Valid signature",
+			urlPath:   "/snippet/extend/1",
+			sig:       sig,
+			csrfToken: csrfToken,
+			wantCode:  http.StatusSeeOther,
+			wantFlash: "Snippet extended for another year",
+		},
+		{
+			name:      "Bad signature",
+			urlPath:   "/snippet/extend/1",
+			sig:       "00ff",
+			csrfToken: csrfToken,
+			wantCode:  http.StatusSeeOther,
+			wantFlash: "That link has expired or has already been used",
+		},
+		{
+			name:      "Missing CSRF token",
+			urlPath:   "/snippet/extend/1",
+			sig:       sig,
+			csrfToken: "",
+			wantCode:  http.StatusBadRequest,
+		},
+		{
+			name:      "Missing snippet",
+			urlPath:   "/snippet/extend/2",
+			sig:       "00ff",
+			csrfToken: csrfToken,
+			wantCode:  http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("sig", tt.sig)
+			form.Add("csrf_token", tt.csrfToken)
+
+			code, headers, _ := ts.postForm(t, tt.urlPath, form)
+			assert.Equal(t, code, tt.wantCode)
+
+			if tt.wantFlash != "" {
+				assert.Equal(t, headers.Get("Location"), "/snippet/view/1")
+
+				_, _, body := ts.get(t, "/snippet/view/1")
+				assert.Equal(t, strings.Contains(body, tt.wantFlash), true)
+			}
+		})
+	}
+}
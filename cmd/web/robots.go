@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// sitemapPageSize is the number of URLs in each page of the sitemap. The protocol allows up
+// to 50,000, but smaller pages are cheaper to generate.
+const sitemapPageSize = 10000
+
+type sitemapIndex struct {
+	XMLName  xml.Name     `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 sitemapindex"`
+	Sitemaps []sitemapLoc `xml:"sitemap"`
+}
+
+type sitemapURLSet struct {
+	XMLName xml.Name     `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 urlset"`
+	URLs    []sitemapLoc `xml:"url"`
+}
+
+type sitemapLoc struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+func (app *application) robotsTxt(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+
+	fmt.Fprint(w, "User-agent: *\n")
+	for _, path := range []string{"/account/", "/admin/", "/user/", "/snippet/create", "/snippet/alias/", "/snippet/extend/", "/snippet/report/"} {
+		fmt.Fprintf(w, "Disallow: %s\n", path)
+	}
+	fmt.Fprintf(w, "\nSitemap: %s/sitemap.xml\n", app.baseURL)
+}
+
+// sitemap serves /sitemap.xml. Without a ?page= parameter it is a sitemap index pointing at
+// each page, and with one it is the list of snippet URLs on that page.
+func (app *application) sitemap(w http.ResponseWriter, r *http.Request) {
+	count, err := app.snippets.CountIndexable()
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	// Always have at least one page, even if it's empty.
+	pages := (count + sitemapPageSize - 1) / sitemapPageSize
+	if pages == 0 {
+		pages = 1
+	}
+
+	var doc any
+
+	if r.URL.Query().Has("page") {
+		page, err := strconv.Atoi(r.URL.Query().Get("page"))
+		if err != nil || page < 1 || page > pages {
+			app.notFound(w)
+			return
+		}
+
+		entries, err := app.snippets.Indexable((page-1)*sitemapPageSize, sitemapPageSize)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+
+		urls := sitemapURLSet{}
+		for _, e := range entries {
+			urls.URLs = append(urls.URLs, sitemapLoc{
+				Loc:     fmt.Sprintf("%s/snippet/view/%d", app.baseURL, e.ID),
+				LastMod: e.PublishAt.UTC().Format(time.RFC3339),
+			})
+		}
+		doc = urls
+	} else {
+		index := sitemapIndex{}
+		for page := 1; page <= pages; page++ {
+			index.Sitemaps = append(index.Sitemaps, sitemapLoc{
+				Loc: fmt.Sprintf("%s/sitemap.xml?page=%d", app.baseURL, page),
+			})
+		}
+		doc = index
+	}
+
+	buf := new(bytes.Buffer)
+	buf.WriteString(xml.Header)
+
+	err = xml.NewEncoder(buf).Encode(doc)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	buf.WriteTo(w)
+}
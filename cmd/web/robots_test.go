@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"snippetbox/internal/assert"
+)
+
+func TestRobotsTxt(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	code, headers, body := ts.get(t, "/robots.txt")
+
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, headers.Get("Content-Type"), "text/plain; charset=utf-8")
+	assert.Equal(t, strings.Contains(body, "Disallow: /admin/\n"), true)
+	assert.Equal(t, strings.Contains(body, "Sitemap: https://snippetbox.test/sitemap.xml\n"), true)
+}
+
+func TestSitemap(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+		wantBody string
+	}{
+		{"Index", "/sitemap.xml", http.StatusOK, "<sitemap><loc>https://snippetbox.test/sitemap.xml?page=1</loc></sitemap>"},
+		{"First page", "/sitemap.xml?page=1", http.StatusOK, "<loc>https://snippetbox.test/snippet/view/1</loc>"},
+		{"Past the end", "/sitemap.xml?page=2", http.StatusNotFound, ""},
+		{"Bad page", "/sitemap.xml?page=x", http.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := ts.get(t, tt.urlPath)
+
+			assert.Equal(t, code, tt.wantCode)
+			assert.Equal(t, strings.Contains(body, tt.wantBody), true)
+		})
+	}
+}
@@ -34,6 +34,16 @@ func (app *application) routes() http.Handler {
 	// Add n new GET /ping route
 	router.HandlerFunc(http.MethodGet, "/ping", ping)
 
+	// The feeds don't use sessions, so they skip the 'dynamic' chain. That also keeps
+	// session cookies out of responses which feed readers and caches will be storing.
+	router.HandlerFunc(http.MethodGet, "/feed.atom", app.feedAtom)
+	router.HandlerFunc(http.MethodGet, "/feed.rss", app.feedRSS)
+	router.HandlerFunc(http.MethodGet, "/feeds/user/:feed", app.feedUser)
+	router.HandlerFunc(http.MethodGet, "/feeds/tag/:feed", app.feedTag)
+	router.HandlerFunc(http.MethodGet, "/robots.txt", app.robotsTxt)
+	router.HandlerFunc(http.MethodGet, "/sitemap.xml", app.sitemap)
+	router.HandlerFunc(http.MethodGet, "/oembed", app.oEmbed)
+
 	// Use the nosurf middleware on all our 'dynamic' routes.
 	dynamic := alice.New(app.sessionManager.LoadAndSave, noSurf, app.authenticate)
 
@@ -42,20 +52,73 @@ func (app *application) routes() http.Handler {
 	// (rather than a http.HandlerFunc) we also need to switch to registering the route using the
 	// router.Handler() method.
 	router.Handler(http.MethodGet, "/", dynamic.ThenFunc(app.home))
+	router.Handler(http.MethodGet, "/trending", dynamic.ThenFunc(app.trendingView))
 	router.Handler(http.MethodGet, "/snippet/view/:id", dynamic.ThenFunc(app.snippetView))
+	router.Handler(http.MethodGet, "/snippet/raw/:id", dynamic.ThenFunc(app.snippetRaw))
+	router.Handler(http.MethodGet, "/s/:alias", dynamic.ThenFunc(app.snippetViewAlias))
+	router.Handler(http.MethodGet, "/snippet/extend/:id", dynamic.ThenFunc(app.snippetExtend))
+	router.Handler(http.MethodPost, "/snippet/extend/:id", dynamic.ThenFunc(app.snippetExtendPost))
 	// Add the five new routes, all of which use our 'dynamic' middleware chain
 	router.Handler(http.MethodGet, "/user/signup", dynamic.ThenFunc(app.userSignup))
 	router.Handler(http.MethodPost, "/user/signup", dynamic.ThenFunc(app.userSignupPost))
 	router.Handler(http.MethodGet, "/user/login", dynamic.ThenFunc(app.userLogin))
 	router.Handler(http.MethodPost, "/user/login", dynamic.ThenFunc(app.userLoginPost))
+	router.Handler(http.MethodGet, "/user/login/2fa", dynamic.ThenFunc(app.twoFactorLogin))
+	router.Handler(http.MethodPost, "/user/login/2fa", dynamic.ThenFunc(app.twoFactorLoginPost))
+	router.Handler(http.MethodGet, "/user/password/forgot", dynamic.ThenFunc(app.passwordForgot))
+	router.Handler(http.MethodPost, "/user/password/forgot", dynamic.ThenFunc(app.passwordForgotPost))
+	router.Handler(http.MethodGet, "/user/password/reset/:token", dynamic.ThenFunc(app.passwordReset))
+	router.Handler(http.MethodPost, "/user/password/reset/:token", dynamic.ThenFunc(app.passwordResetPost))
+	router.Handler(http.MethodGet, "/invite/:token", dynamic.ThenFunc(app.invitation))
+	router.Handler(http.MethodGet, "/user/activate/:token", dynamic.ThenFunc(app.activation))
+	router.Handler(http.MethodPost, "/user/activate/:token", dynamic.ThenFunc(app.activationPost))
 
 	// Because the 'protected' middleware chain appends to the 'dynamic' chain
 	// the noSurf middleware will also be sued on the three routes below too
 	protected := dynamic.Append(app.requireAuthentication)
 
-	router.Handler(http.MethodGet, "/snippet/create", protected.ThenFunc(app.snippetCreate))
-	router.Handler(http.MethodPost, "/snippet/create", protected.ThenFunc(app.snippetCreatePost))
+	// Only users who have verified their email address can post snippets.
+	activated := protected.Append(app.requireActivation)
+
+	router.Handler(http.MethodGet, "/snippet/create", activated.ThenFunc(app.snippetCreate))
+	router.Handler(http.MethodPost, "/snippet/create", activated.ThenFunc(app.snippetCreatePost))
+	router.Handler(http.MethodGet, "/snippet/alias/:id", protected.ThenFunc(app.snippetAlias))
+	router.Handler(http.MethodPost, "/snippet/alias/:id", protected.ThenFunc(app.snippetAliasPost))
+	router.Handler(http.MethodPost, "/snippet/noindex/:id", protected.ThenFunc(app.snippetNoindexPost))
+	router.Handler(http.MethodPost, "/snippet/star/:id", protected.ThenFunc(app.snippetStarPost))
+	router.Handler(http.MethodPost, "/snippet/language/:id", protected.ThenFunc(app.snippetLanguagePost))
+	router.Handler(http.MethodGet, "/snippet/edit/:id", protected.ThenFunc(app.snippetEdit))
+	router.Handler(http.MethodPost, "/snippet/edit/:id", protected.ThenFunc(app.snippetEditPost))
+	router.Handler(http.MethodPost, "/snippet/share/:id", protected.ThenFunc(app.snippetSharePost))
+	router.Handler(http.MethodPost, "/snippet/unshare/:id", protected.ThenFunc(app.snippetUnsharePost))
 	router.Handler(http.MethodPost, "/user/logout", protected.ThenFunc(app.userLogoutPost))
+	router.Handler(http.MethodGet, "/account/view", protected.ThenFunc(app.accountView))
+	router.Handler(http.MethodPost, "/account/activation/resend", protected.ThenFunc(app.activationResendPost))
+	router.Handler(http.MethodGet, "/account/password/update", protected.ThenFunc(app.accountPasswordUpdate))
+	router.Handler(http.MethodPost, "/account/password/update", protected.ThenFunc(app.accountPasswordUpdatePost))
+	router.Handler(http.MethodGet, "/account/2fa", protected.ThenFunc(app.twoFactorView))
+	router.Handler(http.MethodGet, "/account/2fa/qr.png", protected.ThenFunc(app.twoFactorQR))
+	router.Handler(http.MethodPost, "/account/2fa/setup", protected.ThenFunc(app.twoFactorSetupPost))
+	router.Handler(http.MethodPost, "/account/2fa/enable", protected.ThenFunc(app.twoFactorEnablePost))
+	router.Handler(http.MethodPost, "/account/2fa/disable", protected.ThenFunc(app.twoFactorDisablePost))
+	router.Handler(http.MethodGet, "/account/export", protected.ThenFunc(app.accountExport))
+	router.Handler(http.MethodGet, "/account/stats", protected.ThenFunc(app.accountStats))
+	router.Handler(http.MethodPost, "/invite/:token", protected.ThenFunc(app.invitationPost))
+	router.Handler(http.MethodGet, "/orgs", protected.ThenFunc(app.orgList))
+	router.Handler(http.MethodPost, "/orgs/create", protected.ThenFunc(app.orgCreatePost))
+	router.Handler(http.MethodPost, "/orgs/switch", protected.ThenFunc(app.orgSwitchPost))
+	router.Handler(http.MethodGet, "/org/:slug", protected.ThenFunc(app.orgView))
+	router.Handler(http.MethodGet, "/org/:slug/search", protected.ThenFunc(app.orgSearch))
+	router.Handler(http.MethodPost, "/org/:slug/invite", protected.ThenFunc(app.orgInvitePost))
+	router.Handler(http.MethodPost, "/org/:slug/role", protected.ThenFunc(app.orgRolePost))
+	router.Handler(http.MethodPost, "/org/:slug/remove", protected.ThenFunc(app.orgRemovePost))
+
+	// The moderation pages are only for admins, on top of everything 'protected' does.
+	admin := protected.Append(app.requireAdmin)
+
+	router.Handler(http.MethodPost, "/snippet/report/:id", protected.ThenFunc(app.snippetReportPost))
+	router.Handler(http.MethodGet, "/admin/reports", admin.ThenFunc(app.moderationQueue))
+	router.Handler(http.MethodPost, "/admin/reports/:id", admin.ThenFunc(app.moderationResolvePost))
 
 	// Create the middleware chain as normal.
 	standard := alice.New(app.recoverPanic, app.logRequest, secureHeaders)
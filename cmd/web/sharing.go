@@ -0,0 +1,218 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"snippetbox/internal/formatter"
+	"snippetbox/internal/langdetect"
+	"snippetbox/internal/models"
+	"snippetbox/internal/secrets"
+	"snippetbox/internal/validator"
+)
+
+// snippetShareForm is the sharing panel on the view page, which only the owner sees.
+type snippetShareForm struct {
+	Email               string `form:"email"`
+	Permission          string `form:"permission"`
+	validator.Validator `form:"-"`
+}
+
+type snippetUnshareForm struct {
+	UserID              int `form:"user_id"`
+	validator.Validator `form:"-"`
+}
+
+// snippetEditForm changes an existing snippet's title, content and tags. Everything else
+// about a snippet stays as its owner set it up.
+type snippetEditForm struct {
+	Title               string `form:"title"`
+	Content             string `form:"content"`
+	Tags                string `form:"tags"`
+	PublishAnyway       bool   `form:"publish_anyway"`
+	SecretsFound        bool   `form:"-"`
+	validator.Validator `form:"-"`
+}
+
+// snippetSharePost gives another user access to a snippet, or changes the access they
+// already have. Only the owner can do this.
+func (app *application) snippetSharePost(w http.ResponseWriter, r *http.Request) {
+	snippet := app.authorizedSnippet(w, r, models.PermissionOwner)
+	if snippet == nil {
+		return
+	}
+
+	var form snippetShareForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.Email), "email", "This field cannot be blank")
+	form.CheckField(validator.Matches(form.Email, validator.EmailRX), "email", "This field must be a valid email address")
+	form.CheckField(validator.PermittedValue(form.Permission, models.PermissionView, models.PermissionEdit), "permission", "This field must be view or edit")
+
+	if form.Valid() {
+		err = app.acls.Grant(snippet.ID, form.Email, form.Permission)
+		if errors.Is(err, models.ErrNoRecord) {
+			form.AddFieldError("email", "There's nobody else signed up with this email address")
+		} else if err != nil {
+			app.serverError(w, err)
+			return
+		}
+	}
+
+	if !form.Valid() {
+		data, err := app.newSnippetTemplateData(w, r, snippet)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+		data.Form = snippetReportForm{}
+		data.ShareForm = form
+		app.render(w, http.StatusUnprocessableEntity, "view.tmpl", data)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("Shared with %s", form.Email))
+
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", snippet.ID), http.StatusSeeOther)
+}
+
+// snippetUnsharePost takes away a user's access to a snippet.
+func (app *application) snippetUnsharePost(w http.ResponseWriter, r *http.Request) {
+	snippet := app.authorizedSnippet(w, r, models.PermissionOwner)
+	if snippet == nil {
+		return
+	}
+
+	var form snippetUnshareForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil || form.UserID < 1 {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = app.acls.Revoke(snippet.ID, form.UserID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Access removed")
+
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", snippet.ID), http.StatusSeeOther)
+}
+
+// editableSnippet is authorizedSnippet for the edit pages. Snippets encrypted in the
+// browser can't be edited on the server, since we can't read them.
+func (app *application) editableSnippet(w http.ResponseWriter, r *http.Request) *models.Snippet {
+	snippet := app.authorizedSnippet(w, r, models.PermissionEdit)
+	if snippet == nil {
+		return nil
+	}
+
+	if snippet.ClientEncrypted {
+		app.clientError(w, http.StatusBadRequest)
+		return nil
+	}
+
+	return snippet
+}
+
+func (app *application) snippetEdit(w http.ResponseWriter, r *http.Request) {
+	snippet := app.editableSnippet(w, r)
+	if snippet == nil {
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Snippet = snippet
+	data.Form = snippetEditForm{Title: snippet.Title, Content: snippet.Content, Tags: strings.Join(snippet.Tags, " ")}
+
+	app.render(w, http.StatusOK, "edit.tmpl", data)
+}
+
+// snippetEditPost saves changes made by the owner or a co-editor. The checks are the same
+// ones snippetCreatePost makes on new snippets.
+func (app *application) snippetEditPost(w http.ResponseWriter, r *http.Request) {
+	snippet := app.editableSnippet(w, r)
+	if snippet == nil {
+		return
+	}
+
+	var form snippetEditForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.Title), "title", "This field cannot be blank")
+	form.CheckField(validator.MaxChars(form.Title, 100), "title", "This field cannot be more than 100 characters long")
+	form.CheckField(validator.NotBlank(form.Content), "content", "This field cannot be blank")
+
+	tags := parseTags(form.Tags)
+	checkTags(&form.Validator, tags)
+
+	// A language picked by the owner is kept, and the content has to stay valid in it.
+	// One we guessed is guessed again, since the edit may have changed our mind.
+	guess := langdetect.Guess{Language: snippet.Language, Confidence: snippet.LanguageConfidence}
+	if snippet.LanguageConfidence < 1 {
+		guess = langdetect.Detect(form.Title, form.Content)
+	} else if form.Valid() && formatter.Supports(snippet.Language) {
+		_, err = formatter.Format(snippet.Language, form.Content)
+		var syntaxErr *formatter.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			form.AddFieldError("content", fmt.Sprintf("This isn't valid %s. %s", snippet.Language, syntaxErr))
+		} else if err != nil {
+			app.serverError(w, err)
+			return
+		}
+	}
+
+	var findings []secrets.Finding
+	if form.Valid() {
+		findings = app.secretScanner.Scan(form.Content)
+		if len(findings) > 0 && !form.PublishAnyway {
+			for _, f := range findings {
+				form.AddNonFieldError(fmt.Sprintf("Line %d looks like it contains a secret (%s)", f.Line, f.Detector))
+			}
+			form.SecretsFound = true
+		}
+	}
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Snippet = snippet
+		data.Form = form
+		app.render(w, http.StatusUnprocessableEntity, "edit.tmpl", data)
+		return
+	}
+
+	err = app.snippets.Update(snippet.ID, form.Title, form.Content, guess.Language, guess.Confidence)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	err = app.snippets.SetTags(snippet.ID, tags)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	if len(findings) > 0 {
+		app.infoLog.Printf("user %d saved snippet %d despite %d possible secrets", app.authenticatedUserID(r), snippet.ID, len(findings))
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Snippet updated")
+
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", snippet.ID), http.StatusSeeOther)
+}
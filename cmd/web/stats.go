@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"html/template"
+	"net/http"
+	"strings"
+
+	"snippetbox/internal/models"
+)
+
+// statsDays is how many days of activity the stats page charts.
+const statsDays = 30
+
+func (app *application) accountStats(w http.ResponseWriter, r *http.Request) {
+	stats, err := app.snippets.Stats(app.authenticatedUserID(r), statsDays)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Stats = stats
+	data.Chart = activityChart(stats.Daily)
+
+	app.render(w, http.StatusOK, "stats.tmpl", data)
+}
+
+// Dimensions of the activity chart, in SVG user units. The chart scales to fit the page,
+// so these only fix its proportions and the size of the text relative to the bars.
+const (
+	chartWidth  = 600
+	chartHeight = 200
+	chartLeft   = 30 // room for the y axis label
+	chartBottom = 20 // room for the dates
+	chartTop    = 10
+)
+
+// activityChart draws views per day as a bar chart, with a dot over the days when new
+// snippets were created. It's plain SVG built here rather than by a JavaScript library,
+// so the page works under our Content-Security-Policy; colours come from main.css.
+func activityChart(days []*models.DailyActivity) template.HTML {
+	if len(days) == 0 {
+		return ""
+	}
+
+	max := 1
+	for _, d := range days {
+		if d.Views > max {
+			max = d.Views
+		}
+	}
+
+	plotWidth := float64(chartWidth - chartLeft)
+	plotHeight := float64(chartHeight - chartBottom - chartTop)
+	slot := plotWidth / float64(len(days))
+	baseline := float64(chartHeight - chartBottom)
+
+	var b strings.Builder
+
+	fmt.Fprintf(&b, `<svg class="chart" viewBox="0 0 %d %d" role="img" aria-label="Views per day over the last %d days">`,
+		chartWidth, chartHeight, len(days))
+
+	// The axes, and the top of the scale.
+	fmt.Fprintf(&b, `<line class="axis" x1="%d" y1="%d" x2="%d" y2="%.1f"/>`, chartLeft, chartTop, chartLeft, baseline)
+	fmt.Fprintf(&b, `<line class="axis" x1="%d" y1="%.1f" x2="%d" y2="%.1f"/>`, chartLeft, baseline, chartWidth, baseline)
+	fmt.Fprintf(&b, `<text x="%d" y="%d" text-anchor="end">%d</text>`, chartLeft-4, chartTop+8, max)
+	fmt.Fprintf(&b, `<text x="%d" y="%.1f" text-anchor="end">0</text>`, chartLeft-4, baseline)
+
+	for i, d := range days {
+		x := float64(chartLeft) + float64(i)*slot
+		h := plotHeight * float64(d.Views) / float64(max)
+
+		label := fmt.Sprintf("%s: %s, %s", d.Day.Format("2 Jan"), plural(d.Views, "view"), plural(d.Created, "new snippet"))
+
+		fmt.Fprintf(&b, `<g><title>%s</title>`, html.EscapeString(label))
+		fmt.Fprintf(&b, `<rect class="views" x="%.1f" y="%.1f" width="%.1f" height="%.1f"/>`, x+slot*0.1, baseline-h, slot*0.8, h)
+		if d.Created > 0 {
+			fmt.Fprintf(&b, `<circle class="created" cx="%.1f" cy="%.1f" r="3"/>`, x+slot/2, baseline-h-6)
+		}
+		b.WriteString(`</g>`)
+	}
+
+	// Label the first and last days, which is enough to read the rest from.
+	fmt.Fprintf(&b, `<text x="%d" y="%d">%s</text>`, chartLeft, chartHeight-4, days[0].Day.Format("2 Jan"))
+	fmt.Fprintf(&b, `<text x="%d" y="%d" text-anchor="end">%s</text>`, chartWidth, chartHeight-4, days[len(days)-1].Day.Format("2 Jan"))
+
+	b.WriteString(`</svg>`)
+
+	// Everything written above is either a number, a formatted date or escaped, so it's
+	// safe to hand to the template as it is.
+	return template.HTML(b.String())
+}
+
+// plural returns a count with its noun, like "1 view" or "3 views".
+func plural(n int, noun string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, noun)
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"snippetbox/internal/assert"
+	"snippetbox/internal/models"
+)
+
+func TestAccountStats(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	code, headers, _ := ts.get(t, "/account/stats")
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, headers.Get("Location"), "/user/login")
+
+	ts.login(t)
+
+	code, _, body := ts.get(t, "/account/stats")
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, strings.Contains(body, "<td>15</td>"), true)
+	assert.Equal(t, strings.Contains(body, "<th>Stars received</th>"), true)
+	assert.Equal(t, strings.Contains(body, "<td>3</td>"), true)
+	assert.Equal(t, strings.Contains(body, `<svg class="chart"`), true)
+	assert.Equal(t, strings.Contains(body, "<a href='/snippet/view/1'>An old silent pond</a>"), true)
+}
+
+func TestActivityChart(t *testing.T) {
+	day := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	chart := string(activityChart([]*models.DailyActivity{
+		{Day: day, Views: 0},
+		{Day: day.AddDate(0, 0, 1), Views: 4, Created: 1},
+		{Day: day.AddDate(0, 0, 2), Views: 2},
+	}))
+
+	assert.Equal(t, strings.Count(chart, "<rect"), 3)
+	assert.Equal(t, strings.Count(chart, "<circle"), 1)
+	assert.Equal(t, strings.Contains(chart, "<title>2 Mar: 4 views, 1 new snippet</title>"), true)
+	assert.Equal(t, strings.Contains(chart, `text-anchor="end">4</text>`), true)
+
+	// The busiest day fills the plot, and an empty one has no height.
+	assert.Equal(t, strings.Contains(chart, `y="10.0" width="152.0" height="170.0"`), true)
+	assert.Equal(t, strings.Contains(chart, `height="0.0"`), true)
+
+	assert.Equal(t, string(activityChart(nil)), "")
+}
@@ -1,9 +1,13 @@
 package main
 
 import (
+	"fmt"
 	"html/template"
+	"io/fs"
 	"path/filepath"
+	"snippetbox/internal/formatter"
 	"snippetbox/internal/models"
+	"snippetbox/ui"
 	"time"
 )
 
@@ -13,11 +17,51 @@ import (
 type templateData struct {
 	Snippet         *models.Snippet
 	Snippets        []*models.Snippet
-	CurrentYear     int // add a CurrentYear field
-	Form            any // add a Form field with the type "any"
+	Lines           []snippetLine // the numbered lines of Snippet, for the view page
+	CurrentYear     int           // add a CurrentYear field
+	Form            any           // add a Form field with the type "any"
 	Flash           string
 	IsAuthenticated bool
+	IsAdmin         bool
+	UserID          int // the ID of the logged in user, or 0
 	CSRFToken       string
+	Reports         []*models.Report
+	Actions         []*models.ModerationAction
+	Trending        []*models.TrendingSnippet
+	Window          string   // the trending window being shown: day, week or month
+	Robots          string   // content for a robots meta tag, if the page needs one
+	Languages       []string // the languages a snippet can be marked as
+	Formatted       bool     // the snippet is being shown formatted
+	FormatError     string   // why it couldn't be
+	User            *models.User
+	Stats           *models.AccountStats
+	Chart           template.HTML // an inline SVG chart, see activityChart()
+	OpenGraph       *openGraph    // link preview details for a snippet page
+	CanEdit         bool          // the current user may change Snippet
+	CanShare        bool          // the current user owns Snippet: they may share it and change its settings
+	Stars           int           // how many stars Snippet has
+	Starred         bool          // whether the current user is one of them
+	Grants          []*models.Grant
+	ShareForm       any                  // the sharing panel on the view page, alongside the report form in Form
+	Orgs            []*models.Membership // the organizations the user is in, for the nav bar
+	CurrentOrg      *models.Membership   // the one picked with the switcher, or nil for personal
+	Org             *models.Org
+	OrgRole         string // the user's role in Org
+	Members         []*models.Member
+	Invitations     []*models.Invitation
+	Invitation      *models.Invitation
+	InviteToken     string   // the token from Invitation's link, to accept it with
+	Roles           []string // the roles a member of Org can be given
+	Query           string   // what was searched for
+	Truncated       bool     // the search stopped at its limit, so there may be more matches
+	PrevPage        int      // the page before this one of a paginated list, or 0 on the first
+	NextPage        int      // the page after this one, or 0 on the last
+	ResetToken      string   // the token from a password reset link
+	ActivationToken string   // the token from an email verification link
+	ExtendSignature string   // the signature from an expiry reminder's link
+	TwoFactor       *models.TwoFactor
+	TwoFactorKey    string   // the TOTP secret, for typing in by hand, while it's being set up
+	RecoveryCodes   []string // shown once, when two-factor authentication is turned on
 }
 
 // Create a humanDate which returns a nicely formatted string representation of time.Time object.
@@ -31,20 +75,31 @@ func humanDate(t time.Time) string {
 	return t.UTC().Format("02 Jan 2006 at 15:04")
 }
 
+// percent formats a fraction between 0 and 1 as a whole percentage, like "87%".
+func percent(f float64) string {
+	return fmt.Sprintf("%.0f%%", f*100)
+}
+
 // Initialize a template.FuncMap object and store it in a global variable. This is essentially a string-keyed map which
 // act as a lookup between the names of our custom template functions and the functions themselves
 var functions = template.FuncMap{
-	"humanDate": humanDate,
+	"humanDate":   humanDate,
+	"percent":     percent,
+	"formattable": formatter.Supports,
+	"canManage":   canManage,
+	"article":     article,
 }
 
 func newTemplateChache() (map[string]*template.Template, error) {
 	// initialize a new map to act as the cache
 	cache := map[string]*template.Template{}
 
-	// Use the filepath.Glob() function to get a slice of all filepaths that match the pattern
-	// "./ui/html/pages/*.tmpl". This will essentially give us a slice of all the filepaths for
-	// our application 'page' templates like (ui/html/pages/home.tmpl ui/html/pages/view.tmpl)
-	pages, err := filepath.Glob("./ui/html/pages/*.tmpl")
+	// Use the fs.Glob() function to get a slice of all filepaths in the ui.Files embedded
+	// filesystem which match the pattern "html/pages/*.tmpl". This will essentially give us
+	// a slice of all the filepaths for our application 'page' templates like
+	// (html/pages/home.tmpl html/pages/view.tmpl). Reading from the embedded filesystem means
+	// the templates are found regardless of the working directory (including under go test).
+	pages, err := fs.Glob(ui.Files, "html/pages/*.tmpl")
 	if err != nil {
 		return nil, err
 	}
@@ -54,22 +109,18 @@ func newTemplateChache() (map[string]*template.Template, error) {
 		// Extract the file name (like 'home.tmpl') from the full filepath and assign it to the name variable
 		name := filepath.Base(page)
 
-		// The template.FuncMap must be registered with the template set before you call the ParseFiles() method.
-		// This means we have to use template.New() to create an empty template set, use the Funcs() method to register
-		// the template.FuncMap, and then parse the file as normal.
-		ts, err := template.New(name).Funcs(functions).ParseFiles("./ui/html/base.tmpl")
-		if err != nil {
-			return nil, err
-		}
-
-		// Call ParseGlob() *on this template set* to add any partials
-		ts, err = ts.ParseGlob("./ui/html/partials/*.tmpl")
-		if err != nil {
-			return nil, err
+		// Create a slice containing the filepath patterns for the templates we want to parse:
+		// the base layout, any partials and then the page template itself.
+		patterns := []string{
+			"html/base.tmpl",
+			"html/partials/*.tmpl",
+			page,
 		}
 
-		// Call ParseFiles() *on this template set* to add the page template
-		ts, err = ts.ParseFiles(page)
+		// The template.FuncMap must be registered with the template set before you call the ParseFS() method.
+		// This means we have to use template.New() to create an empty template set, use the Funcs() method to register
+		// the template.FuncMap, and then parse the files from the embedded filesystem.
+		ts, err := template.New(name).Funcs(functions).ParseFS(ui.Files, patterns...)
 		if err != nil {
 			return nil, err
 		}
@@ -2,12 +2,18 @@ package main
 
 import (
 	"bytes"
+	"html"
 	"io"
 	"log"
 	"net/http"
 	"net/http/cookiejar"
 	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"snippetbox/internal/mailer"
 	"snippetbox/internal/models/mocks"
+	"snippetbox/internal/secrets"
+	"sync"
 	"testing"
 	"time"
 
@@ -40,12 +46,38 @@ func newTestApplication(t *testing.T) *application {
 		infoLog:        log.New(io.Discard, "", 0),
 		snippets:       &mocks.SnippetModel{},
 		users:          &mocks.UserModel{},
+		reports:        &mocks.ReportModel{},
+		acls:           &mocks.ACLModel{},
+		orgs:           &mocks.OrgModel{},
+		tokens:         &mocks.TokenModel{},
+		twoFactor:      &mocks.TwoFactorModel{},
+		loginAttempts:  &mocks.LoginAttemptModel{},
 		templateCache:  templateCache,
 		formDecoder:    formDecoder,
 		sessionManager: sessionManager,
+		secretScanner:  secrets.NewScanner(secrets.DefaultDetectors()...),
+		mailer:         &testMailer{},
+		baseURL:        "https://snippetbox.test",
+		secretKey:      []byte("test secret"),
+		trending:       newTrendingCache(),
 	}
 }
 
+// testMailer keeps the messages it is asked to send so that tests can inspect them. Some
+// are sent from background goroutines: call app.wg.Wait() before looking at messages.
+type testMailer struct {
+	mu       sync.Mutex
+	messages []mailer.Message
+}
+
+func (m *testMailer) Send(msg mailer.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
 // Define a custom testServer type which embed a httptest.Server instance
 type testServer struct {
 	*httptest.Server
@@ -94,3 +126,63 @@ func (ts *testServer) get(t *testing.T, urlPath string) (int, http.Header, strin
 
 	return rs.StatusCode, rs.Header, string(body)
 }
+
+// Define a regular expression which captures the CSRF token value from the
+// HTML for our user signup and login pages.
+var csrfTokenRX = regexp.MustCompile(`<input type='hidden' name='csrf_token' value='(.+)'>`)
+
+func extractCSRFToken(t *testing.T, body string) string {
+	// Use the FindStringSubmatch method to extract the token from the HTML body.
+	// Note that this returns an array with the entire matched pattern in the
+	// first position, and the values of any captured data in the subsequent
+	// positions.
+	matches := csrfTokenRX.FindStringSubmatch(body)
+	if len(matches) < 2 {
+		t.Fatal("no csrf token found in body")
+	}
+
+	return html.UnescapeString(string(matches[1]))
+}
+
+// Create a postForm method for sending POST requests to the test server. The
+// final parameter to this method is a url.Values object which can contain any
+// form data that you want to send in the request body.
+func (ts *testServer) postForm(t *testing.T, urlPath string, form url.Values) (int, http.Header, string) {
+	rs, err := ts.Client().PostForm(ts.URL+urlPath, form)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Read the response body from the test server.
+	defer rs.Body.Close()
+	body, err := io.ReadAll(rs.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bytes.TrimSpace(body)
+
+	// Return the response status, headers and body.
+	return rs.StatusCode, rs.Header, string(body)
+}
+
+// login signs the test server client in as the mock user with ID 1, so that
+// subsequent requests made with the same client are authenticated.
+func (ts *testServer) login(t *testing.T) {
+	ts.loginAs(t, "alice@example.com")
+}
+
+// loginAs signs in as one of the other mock users, such as bob@example.com (ID 2), who
+// owns no snippets but has been given access to some of alice's.
+func (ts *testServer) loginAs(t *testing.T, email string) {
+	_, _, body := ts.get(t, "/user/login")
+
+	form := url.Values{}
+	form.Add("email", email)
+	form.Add("password", "pa$$word")
+	form.Add("csrf_token", extractCSRFToken(t, body))
+
+	code, _, _ := ts.postForm(t, "/user/login", form)
+	if code != http.StatusSeeOther {
+		t.Fatalf("login failed with status %d", code)
+	}
+}
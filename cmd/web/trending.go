@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"snippetbox/internal/models"
+)
+
+// trendingWindows maps the ?window= values the trending page accepts to a number of days.
+var trendingWindows = map[string]int{
+	"day":   1,
+	"week":  7,
+	"month": 30,
+}
+
+// trendingLimit is how many snippets the trending page lists.
+const trendingLimit = 20
+
+// trendingCache holds the most recently computed trending list for each window. Ranking
+// means aggregating snippet_views, which we'd rather not do on every page view, so the
+// lists are recomputed in the background and the handler just reads them.
+type trendingCache struct {
+	mu      sync.RWMutex
+	results map[string][]*models.TrendingSnippet
+}
+
+func newTrendingCache() *trendingCache {
+	return &trendingCache{results: map[string][]*models.TrendingSnippet{}}
+}
+
+func (c *trendingCache) get(window string) ([]*models.TrendingSnippet, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	results, ok := c.results[window]
+	return results, ok
+}
+
+func (c *trendingCache) set(window string, results []*models.TrendingSnippet) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.results[window] = results
+}
+
+// refreshTrending recomputes the trending list for every window.
+func (app *application) refreshTrending() error {
+	for window, days := range trendingWindows {
+		results, err := app.snippets.Trending(days, trendingLimit)
+		if err != nil {
+			return err
+		}
+		app.trending.set(window, results)
+	}
+	return nil
+}
+
+// scheduleTrendingRefresh keeps the trending cache up to date by refreshing it every interval.
+func (app *application) scheduleTrendingRefresh(interval time.Duration) {
+	go func() {
+		defer func() {
+			if err := recover(); err != nil {
+				app.errorLog.Output(2, fmt.Sprintf("trending refresh: %s", err))
+			}
+		}()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			err := app.refreshTrending()
+			if err != nil {
+				app.errorLog.Output(2, fmt.Sprintf("trending refresh: %s", err))
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+func (app *application) trendingView(w http.ResponseWriter, r *http.Request) {
+	window := r.URL.Query().Get("window")
+	if window == "" {
+		window = "week"
+	}
+
+	days, ok := trendingWindows[window]
+	if !ok {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	// The cache is normally filled by the background refresh, but if a request beats the
+	// first refresh to it, work the list out now and keep it.
+	results, ok := app.trending.get(window)
+	if !ok {
+		var err error
+		results, err = app.snippets.Trending(days, trendingLimit)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+		app.trending.set(window, results)
+	}
+
+	data := app.newTemplateData(r)
+	data.Trending = results
+	data.Window = window
+
+	app.render(w, http.StatusOK, "trending.tmpl", data)
+}
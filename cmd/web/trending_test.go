@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"snippetbox/internal/assert"
+)
+
+func TestTrendingView(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+		wantBody string
+	}{
+		{"Default window", "/trending", http.StatusOK, "<strong>This week</strong>"},
+		{"Day", "/trending?window=day", http.StatusOK, "<strong>Today</strong>"},
+		{"Month", "/trending?window=month", http.StatusOK, "<td>30</td>"},
+		{"Stars", "/trending", http.StatusOK, "<th>Stars</th>"},
+		{"Unknown window", "/trending?window=year", http.StatusBadRequest, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := ts.get(t, tt.urlPath)
+
+			assert.Equal(t, code, tt.wantCode)
+			assert.Equal(t, strings.Contains(body, tt.wantBody), true)
+		})
+	}
+
+	// Once the cache has been filled, the handler should serve from it.
+	_, ok := app.trending.get("week")
+	assert.Equal(t, ok, true)
+}
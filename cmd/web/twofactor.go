@@ -0,0 +1,501 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"snippetbox/internal/models"
+	"snippetbox/internal/totp"
+	"snippetbox/internal/validator"
+
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// twoFactorLoginTimeout is how long someone has, after entering their password, to enter
+// the code from their authenticator app.
+const twoFactorLoginTimeout = 5 * time.Minute
+
+// maxTwoFactorAttempts is how many wrong codes can be entered before the password has to
+// be entered again. There are only a million codes, so guessing has to be slow.
+const maxTwoFactorAttempts = 5
+
+// recoveryCodeCount is how many recovery codes users get when they turn on two-factor
+// authentication.
+const recoveryCodeCount = 10
+
+type twoFactorLoginForm struct {
+	Code                string `form:"code"`
+	validator.Validator `form:"-"`
+}
+
+type twoFactorEnableForm struct {
+	Code                string `form:"code"`
+	validator.Validator `form:"-"`
+}
+
+type twoFactorDisableForm struct {
+	Password            string `form:"password"`
+	validator.Validator `form:"-"`
+}
+
+// beginTwoFactorLogin is the first half of logging in someone with two-factor
+// authentication turned on. They've given the right password, but they aren't logged in:
+// the session only remembers who they said they were, for twoFactorLoginTimeout, while
+// they get their code. email is what they typed in to log in with, which wrong codes are
+// counted against just like wrong passwords.
+func (app *application) beginTwoFactorLogin(w http.ResponseWriter, r *http.Request, userID int, email string) {
+	err := app.sessionManager.RenewToken(r.Context())
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "twoFactorUserID", userID)
+	app.sessionManager.Put(r.Context(), "twoFactorEmail", email)
+	app.sessionManager.Put(r.Context(), "twoFactorExpires", time.Now().Add(twoFactorLoginTimeout).Unix())
+	app.sessionManager.Remove(r.Context(), "twoFactorAttempts")
+
+	http.Redirect(w, r, "/user/login/2fa", http.StatusSeeOther)
+}
+
+// pendingTwoFactorUserID returns the ID of the user who is halfway through logging in, or
+// 0 if nobody is (or they took too long).
+func (app *application) pendingTwoFactorUserID(r *http.Request) int {
+	if time.Now().Unix() > app.sessionManager.GetInt64(r.Context(), "twoFactorExpires") {
+		return 0
+	}
+
+	return app.sessionManager.GetInt(r.Context(), "twoFactorUserID")
+}
+
+// abandonTwoFactorLogin forgets about a half finished login and sends the user back to
+// enter their password again.
+func (app *application) abandonTwoFactorLogin(w http.ResponseWriter, r *http.Request, flash string) {
+	app.sessionManager.Remove(r.Context(), "twoFactorUserID")
+	app.sessionManager.Remove(r.Context(), "twoFactorEmail")
+	app.sessionManager.Remove(r.Context(), "twoFactorExpires")
+	app.sessionManager.Remove(r.Context(), "twoFactorAttempts")
+
+	if flash != "" {
+		app.sessionManager.Put(r.Context(), "flash", flash)
+	}
+
+	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+}
+
+func (app *application) twoFactorLogin(w http.ResponseWriter, r *http.Request) {
+	if app.pendingTwoFactorUserID(r) == 0 {
+		app.abandonTwoFactorLogin(w, r, "")
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Form = twoFactorLoginForm{}
+
+	app.render(w, http.StatusOK, "twofactorlogin.tmpl", data)
+}
+
+func (app *application) twoFactorLoginPost(w http.ResponseWriter, r *http.Request) {
+	userID := app.pendingTwoFactorUserID(r)
+	if userID == 0 {
+		app.abandonTwoFactorLogin(w, r, "That took too long. Please log in again.")
+		return
+	}
+
+	var form twoFactorLoginForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.Code), "code", "This field cannot be blank")
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, http.StatusUnprocessableEntity, "twofactorlogin.tmpl", data)
+		return
+	}
+
+	// The limits on failed logins cover this step too. Otherwise anyone who knew the
+	// password could keep starting over for another maxTwoFactorAttempts guesses.
+	email := app.sessionManager.GetString(r.Context(), "twoFactorEmail")
+	ip := clientIP(r)
+
+	until, err := app.loginLockedUntil(email, ip)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	if time.Now().Before(until) {
+		app.abandonTwoFactorLogin(w, r, "Too many failed login attempts. Please wait a while and try again.")
+		return
+	}
+
+	// Six digits is a code from the app. Anything else might be a recovery code.
+	code := strings.ReplaceAll(strings.TrimSpace(form.Code), " ", "")
+	valid := false
+	remaining := -1
+
+	if len(code) == totp.Digits && strings.Trim(code, "0123456789") == "" {
+		valid, err = app.checkTOTP(userID, code)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+	} else {
+		remaining, err = app.twoFactor.UseRecoveryCode(userID, code)
+		if err == nil {
+			valid = true
+		} else if !errors.Is(err, models.ErrNoRecord) {
+			app.serverError(w, err)
+			return
+		}
+	}
+
+	if !valid {
+		err = app.loginFailed(email, ip)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+
+		attempts := app.sessionManager.GetInt(r.Context(), "twoFactorAttempts") + 1
+		if attempts >= maxTwoFactorAttempts {
+			app.abandonTwoFactorLogin(w, r, "Too many incorrect codes. Please log in again.")
+			return
+		}
+		app.sessionManager.Put(r.Context(), "twoFactorAttempts", attempts)
+
+		form.AddFieldError("code", "This code isn't valid. Check your authenticator app and try again")
+
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, http.StatusUnprocessableEntity, "twofactorlogin.tmpl", data)
+		return
+	}
+
+	err = app.loginSucceeded(email)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	// Now they're logged in, which calls for a new session token, just as it does after
+	// the password for anyone without two-factor authentication.
+	err = app.sessionManager.RenewToken(r.Context())
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.sessionManager.Remove(r.Context(), "twoFactorUserID")
+	app.sessionManager.Remove(r.Context(), "twoFactorEmail")
+	app.sessionManager.Remove(r.Context(), "twoFactorExpires")
+	app.sessionManager.Remove(r.Context(), "twoFactorAttempts")
+	app.sessionManager.Put(r.Context(), "authenticatedUserID", userID)
+
+	if remaining >= 0 {
+		app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("You logged in with a recovery code. You have %d left.", remaining))
+	}
+
+	http.Redirect(w, r, "/snippet/create", http.StatusSeeOther)
+}
+
+// checkTOTP reports whether code is the current code from the user's authenticator app,
+// and hasn't been used already.
+func (app *application) checkTOTP(userID int, code string) (bool, error) {
+	tf, err := app.twoFactor.Get(userID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	counter, ok := totp.Validate(tf.Secret, code, time.Now())
+	if !ok {
+		return false, nil
+	}
+
+	return app.twoFactor.UseCounter(userID, counter)
+}
+
+// twoFactorView is the page for turning two-factor authentication on and off. What it
+// shows depends on how far the user has got: nothing set up, a QR code to scan, or
+// turned on.
+func (app *application) twoFactorView(w http.ResponseWriter, r *http.Request) {
+	tf, err := app.twoFactor.Get(app.authenticatedUserID(r))
+	if err != nil && !errors.Is(err, models.ErrNoRecord) {
+		app.serverError(w, err)
+		return
+	}
+
+	if tf != nil && tf.Enabled {
+		app.renderTwoFactor(w, r, tf, twoFactorDisableForm{}, http.StatusOK)
+	} else {
+		app.renderTwoFactor(w, r, tf, twoFactorEnableForm{}, http.StatusOK)
+	}
+}
+
+// renderTwoFactor shows the two-factor authentication page. tf is nil if the user hasn't
+// started setting it up.
+func (app *application) renderTwoFactor(w http.ResponseWriter, r *http.Request, tf *models.TwoFactor, form any, status int) {
+	data := app.newTemplateData(r)
+	data.TwoFactor = tf
+	data.Form = form
+
+	if tf != nil && !tf.Enabled {
+		data.TwoFactorKey = totp.EncodeSecret(tf.Secret)
+	}
+
+	// The page can have the secret on it; it shouldn't be kept anywhere.
+	w.Header().Set("Cache-Control", "no-store")
+
+	app.render(w, status, "twofactor.tmpl", data)
+}
+
+// twoFactorSetupPost starts setting up two-factor authentication with a new secret.
+func (app *application) twoFactorSetupPost(w http.ResponseWriter, r *http.Request) {
+	secret, err := totp.NewSecret()
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	err = app.twoFactor.Begin(app.authenticatedUserID(r), secret)
+	if err != nil {
+		if errors.Is(err, models.ErrNoKeys) {
+			app.sessionManager.Put(r.Context(), "flash", "Two-factor authentication isn't available, because this server has no encryption keys set up.")
+		} else {
+			app.serverError(w, err)
+			return
+		}
+	}
+
+	http.Redirect(w, r, "/account/2fa", http.StatusSeeOther)
+}
+
+// twoFactorQR serves the QR code for the user's authenticator app. It's only there while
+// they're setting up: once two-factor authentication is on, showing the secret again
+// would let anyone who got hold of their session copy their authenticator.
+func (app *application) twoFactorQR(w http.ResponseWriter, r *http.Request) {
+	userID := app.authenticatedUserID(r)
+
+	tf, err := app.twoFactor.Get(userID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+	if tf.Enabled {
+		app.notFound(w)
+		return
+	}
+
+	user, err := app.users.Get(userID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	png, err := qrcode.Encode(totp.URL("Snippetbox", user.Email, tf.Secret), qrcode.Medium, 256)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(png)
+}
+
+// twoFactorEnablePost turns on two-factor authentication, once the user has shown their
+// app is giving the right codes, and shows them their recovery codes. This is the only
+// time they're shown.
+func (app *application) twoFactorEnablePost(w http.ResponseWriter, r *http.Request) {
+	userID := app.authenticatedUserID(r)
+
+	var form twoFactorEnableForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	tf, err := app.twoFactor.Get(userID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.Redirect(w, r, "/account/2fa", http.StatusSeeOther)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+	if tf.Enabled {
+		http.Redirect(w, r, "/account/2fa", http.StatusSeeOther)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.Code), "code", "This field cannot be blank")
+
+	if form.Valid() {
+		counter, ok := totp.Validate(tf.Secret, strings.ReplaceAll(strings.TrimSpace(form.Code), " ", ""), time.Now())
+		if ok {
+			// Use the code up, so it can't be used to log in as well.
+			_, err = app.twoFactor.UseCounter(userID, counter)
+			if err != nil {
+				app.serverError(w, err)
+				return
+			}
+		} else {
+			form.AddFieldError("code", "This code isn't valid. Check the time on your device is right and try again")
+		}
+	}
+
+	if !form.Valid() {
+		app.renderTwoFactor(w, r, tf, form, http.StatusUnprocessableEntity)
+		return
+	}
+
+	codes, err := newRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	err = app.twoFactor.Enable(userID, codes)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	tf.Enabled = true
+
+	data := app.newTemplateData(r)
+	data.TwoFactor = tf
+	data.Form = twoFactorDisableForm{}
+	data.RecoveryCodes = codes
+	data.Flash = "Two-factor authentication is now turned on."
+
+	w.Header().Set("Cache-Control", "no-store")
+
+	app.render(w, http.StatusOK, "twofactor.tmpl", data)
+}
+
+// twoFactorDisablePost turns off two-factor authentication. Somebody who has got hold of a
+// logged in session shouldn't be able to do that, so it takes the password too.
+func (app *application) twoFactorDisablePost(w http.ResponseWriter, r *http.Request) {
+	userID := app.authenticatedUserID(r)
+
+	var form twoFactorDisableForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.Password), "password", "This field cannot be blank")
+
+	// Wrong passwords here count towards the same limits as on the login page. Otherwise
+	// anyone who got hold of a session could guess at the password as fast as they liked.
+	status := http.StatusUnprocessableEntity
+
+	if form.Valid() {
+		user, err := app.users.Get(userID)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+
+		ip := clientIP(r)
+
+		until, err := app.loginLockedUntil(user.Email, ip)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+
+		if time.Now().Before(until) {
+			form.AddFieldError("password", "Too many failed attempts. Please wait a while and try again.")
+			w.Header().Set("Retry-After", fmt.Sprint(int(time.Until(until).Seconds())+1))
+			status = http.StatusTooManyRequests
+		} else {
+			matches, err := app.users.PasswordMatches(userID, form.Password)
+			if err != nil {
+				app.serverError(w, err)
+				return
+			}
+
+			if matches {
+				err = app.loginSucceeded(user.Email)
+			} else {
+				err = app.loginFailed(user.Email, ip)
+			}
+			if err != nil {
+				app.serverError(w, err)
+				return
+			}
+
+			form.CheckField(matches, "password", "Password is incorrect")
+		}
+	}
+
+	if !form.Valid() {
+		tf, err := app.twoFactor.Get(userID)
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				http.Redirect(w, r, "/account/2fa", http.StatusSeeOther)
+			} else {
+				app.serverError(w, err)
+			}
+			return
+		}
+
+		app.renderTwoFactor(w, r, tf, form, status)
+		return
+	}
+
+	err = app.twoFactor.Disable(userID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Two-factor authentication has been turned off.")
+
+	http.Redirect(w, r, "/account/view", http.StatusSeeOther)
+}
+
+// newRecoveryCodes returns n random codes like "k3j9x-a2mqp": 50 bits each, which is
+// plenty for something which can only be tried a few times before the password has to be
+// entered again.
+func newRecoveryCodes(n int) ([]string, error) {
+	encoding := base32.StdEncoding.WithPadding(base32.NoPadding)
+
+	codes := make([]string, n)
+	for i := range codes {
+		b := make([]byte, 7)
+		_, err := rand.Read(b)
+		if err != nil {
+			return nil, err
+		}
+
+		code := strings.ToLower(encoding.EncodeToString(b))[:10]
+		codes[i] = code[:5] + "-" + code[5:]
+	}
+
+	return codes, nil
+}
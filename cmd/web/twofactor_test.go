@@ -0,0 +1,297 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"snippetbox/internal/assert"
+	"snippetbox/internal/models/mocks"
+	"snippetbox/internal/totp"
+)
+
+// loginTwoFactor gets erin, who has two-factor authentication turned on, past the
+// password, and returns the CSRF token from the page asking for her code.
+func (ts *testServer) loginTwoFactor(t *testing.T) string {
+	_, _, body := ts.get(t, "/user/login")
+
+	form := url.Values{}
+	form.Add("email", "erin@example.com")
+	form.Add("password", "pa$$word")
+	form.Add("csrf_token", extractCSRFToken(t, body))
+
+	code, headers, _ := ts.postForm(t, "/user/login", form)
+	if code != http.StatusSeeOther || headers.Get("Location") != "/user/login/2fa" {
+		t.Fatalf("login didn't ask for a code: status %d, location %q", code, headers.Get("Location"))
+	}
+
+	_, _, body = ts.get(t, "/user/login/2fa")
+	return extractCSRFToken(t, body)
+}
+
+// wrongCode returns a six digit code which isn't valid for secret at the moment.
+func wrongCode(secret []byte) string {
+	code := []byte(totp.Code(secret, time.Now()))
+	code[0] = '0' + (code[0]-'0'+5)%10
+	return string(code)
+}
+
+func TestTwoFactorLogin(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	// With nobody halfway through logging in, there's nothing to enter a code for.
+	code, headers, _ := ts.get(t, "/user/login/2fa")
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, headers.Get("Location"), "/user/login")
+
+	csrfToken := ts.loginTwoFactor(t)
+
+	// The password alone doesn't log erin in.
+	code, headers, _ = ts.get(t, "/account/view")
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, headers.Get("Location"), "/user/login")
+
+	tests := []struct {
+		name     string
+		code     string
+		wantCode int
+		wantBody string
+	}{
+		{"Blank", "", http.StatusUnprocessableEntity, "This field cannot be blank"},
+		{"Wrong code", wrongCode(mocks.MockTOTPSecret), http.StatusUnprocessableEntity, "This code isn&#39;t valid"},
+		{"Wrong recovery code", "zzzzz-zzzzz", http.StatusUnprocessableEntity, "This code isn&#39;t valid"},
+		{"Valid", totp.Code(mocks.MockTOTPSecret, time.Now()), http.StatusSeeOther, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("code", tt.code)
+			form.Add("csrf_token", csrfToken)
+
+			code, headers, body := ts.postForm(t, "/user/login/2fa", form)
+
+			assert.Equal(t, code, tt.wantCode)
+			if tt.wantCode == http.StatusSeeOther {
+				assert.Equal(t, headers.Get("Location"), "/snippet/create")
+			}
+			assert.Equal(t, strings.Contains(body, tt.wantBody), true)
+		})
+	}
+
+	code, _, _ = ts.get(t, "/account/view")
+	assert.Equal(t, code, http.StatusOK)
+}
+
+func TestTwoFactorLoginReplay(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	totpCode := totp.Code(mocks.MockTOTPSecret, time.Now())
+
+	csrfToken := ts.loginTwoFactor(t)
+	code, _, _ := ts.postForm(t, "/user/login/2fa", url.Values{"code": {totpCode}, "csrf_token": {csrfToken}})
+	assert.Equal(t, code, http.StatusSeeOther)
+
+	// Somebody who saw the code can't use it to log in again.
+	other := newTestServer(t, app.routes())
+	defer other.Close()
+
+	csrfToken = other.loginTwoFactor(t)
+	code, _, _ = other.postForm(t, "/user/login/2fa", url.Values{"code": {totpCode}, "csrf_token": {csrfToken}})
+	assert.Equal(t, code, http.StatusUnprocessableEntity)
+
+	// A recovery code works, but only once.
+	code, _, _ = other.postForm(t, "/user/login/2fa", url.Values{"code": {"abcde-fghij"}, "csrf_token": {csrfToken}})
+	assert.Equal(t, code, http.StatusSeeOther)
+
+	_, _, body := other.get(t, "/account/view")
+	assert.Equal(t, strings.Contains(body, "You logged in with a recovery code. You have 1 left."), true)
+
+	third := newTestServer(t, app.routes())
+	defer third.Close()
+
+	csrfToken = third.loginTwoFactor(t)
+	code, _, _ = third.postForm(t, "/user/login/2fa", url.Values{"code": {"abcde-fghij"}, "csrf_token": {csrfToken}})
+	assert.Equal(t, code, http.StatusUnprocessableEntity)
+}
+
+func TestTwoFactorLoginAttempts(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	csrfToken := ts.loginTwoFactor(t)
+	form := url.Values{"code": {wrongCode(mocks.MockTOTPSecret)}, "csrf_token": {csrfToken}}
+
+	for i := 1; i < maxTwoFactorAttempts; i++ {
+		code, _, _ := ts.postForm(t, "/user/login/2fa", form)
+		assert.Equal(t, code, http.StatusUnprocessableEntity)
+	}
+
+	// One too many, and the password has to be entered again.
+	code, headers, _ := ts.postForm(t, "/user/login/2fa", form)
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, headers.Get("Location"), "/user/login")
+
+	form.Set("code", totp.Code(mocks.MockTOTPSecret, time.Now()))
+	code, headers, _ = ts.postForm(t, "/user/login/2fa", form)
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, headers.Get("Location"), "/user/login")
+}
+
+func TestTwoFactorLoginNoKeys(t *testing.T) {
+	app := newTestApplication(t)
+	app.twoFactor.(*mocks.TwoFactorModel).NoKeys = true
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	// Without the keys there's no checking erin's code, so the password alone mustn't do.
+	code, _, body := ts.tryLogin(t, "erin@example.com", "pa$$word")
+	assert.Equal(t, code, http.StatusServiceUnavailable)
+	assert.Equal(t, strings.Contains(body, "Logging in to this account isn&#39;t possible right now"), true)
+
+	code, headers, _ := ts.get(t, "/account/view")
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, headers.Get("Location"), "/user/login")
+
+	// Users without two-factor authentication aren't affected.
+	code, headers, _ = ts.tryLogin(t, "alice@example.com", "pa$$word")
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, headers.Get("Location"), "/snippet/create")
+}
+
+func TestTwoFactorSetup(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	ts.login(t)
+
+	code, _, body := ts.get(t, "/account/2fa")
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, strings.Contains(body, "Set up two-factor authentication"), true)
+	csrfToken := extractCSRFToken(t, body)
+
+	// There's no QR code until a secret has been picked.
+	code, _, _ = ts.get(t, "/account/2fa/qr.png")
+	assert.Equal(t, code, http.StatusNotFound)
+
+	code, headers, _ := ts.postForm(t, "/account/2fa/setup", url.Values{"csrf_token": {csrfToken}})
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, headers.Get("Location"), "/account/2fa")
+
+	tf, err := app.twoFactor.Get(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, headers, body = ts.get(t, "/account/2fa")
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, headers.Get("Cache-Control"), "no-store")
+	assert.Equal(t, strings.Contains(body, "<img class='qr' src='/account/2fa/qr.png'"), true)
+	assert.Equal(t, strings.Contains(body, totp.EncodeSecret(tf.Secret)), true)
+
+	code, headers, body = ts.get(t, "/account/2fa/qr.png")
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, headers.Get("Content-Type"), "image/png")
+	assert.Equal(t, strings.HasPrefix(body, "\x89PNG"), true)
+
+	code, _, body = ts.postForm(t, "/account/2fa/enable", url.Values{"code": {wrongCode(tf.Secret)}, "csrf_token": {csrfToken}})
+	assert.Equal(t, code, http.StatusUnprocessableEntity)
+	assert.Equal(t, strings.Contains(body, "This code isn&#39;t valid"), true)
+
+	code, _, body = ts.postForm(t, "/account/2fa/enable", url.Values{"code": {totp.Code(tf.Secret, time.Now())}, "csrf_token": {csrfToken}})
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, strings.Contains(body, "These are your recovery codes"), true)
+	assert.Equal(t, strings.Count(body, "<li><code>"), recoveryCodeCount)
+
+	// Now it's on, the secret isn't shown again.
+	code, _, body = ts.get(t, "/account/2fa")
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, strings.Contains(body, totp.EncodeSecret(tf.Secret)), false)
+
+	code, _, _ = ts.get(t, "/account/2fa/qr.png")
+	assert.Equal(t, code, http.StatusNotFound)
+
+	_, _, body = ts.get(t, "/account/view")
+	assert.Equal(t, strings.Contains(body, "On\n"), true)
+}
+
+func TestTwoFactorDisable(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	csrfToken := ts.loginTwoFactor(t)
+	code, _, _ := ts.postForm(t, "/user/login/2fa", url.Values{"code": {"klmno-pqrst"}, "csrf_token": {csrfToken}})
+	assert.Equal(t, code, http.StatusSeeOther)
+
+	_, _, body := ts.get(t, "/account/2fa")
+	assert.Equal(t, strings.Contains(body, "Turn off two-factor authentication"), true)
+	csrfToken = extractCSRFToken(t, body)
+
+	tests := []struct {
+		name     string
+		password string
+		wantCode int
+		wantBody string
+	}{
+		{"Blank", "", http.StatusUnprocessableEntity, "This field cannot be blank"},
+		{"Wrong password", "wrongPa$$word", http.StatusUnprocessableEntity, "Password is incorrect"},
+		{"Valid", "pa$$word", http.StatusSeeOther, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := ts.postForm(t, "/account/2fa/disable", url.Values{"password": {tt.password}, "csrf_token": {csrfToken}})
+
+			assert.Equal(t, code, tt.wantCode)
+			assert.Equal(t, strings.Contains(body, tt.wantBody), true)
+		})
+	}
+
+	_, _, body = ts.get(t, "/account/2fa")
+	assert.Equal(t, strings.Contains(body, "Set up two-factor authentication"), true)
+}
+
+func TestTwoFactorDisableLockout(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	csrfToken := ts.loginTwoFactor(t)
+	code, _, _ := ts.postForm(t, "/user/login/2fa", url.Values{"code": {"klmno-pqrst"}, "csrf_token": {csrfToken}})
+	assert.Equal(t, code, http.StatusSeeOther)
+
+	_, _, body := ts.get(t, "/account/2fa")
+	csrfToken = extractCSRFToken(t, body)
+
+	// Someone with erin's session gets no more guesses at her password than they would on
+	// the login page.
+	for i := 0; i < accountLockout.freeAttempts; i++ {
+		code, _, body := ts.postForm(t, "/account/2fa/disable", url.Values{"password": {"wrongPa$$word"}, "csrf_token": {csrfToken}})
+		assert.Equal(t, code, http.StatusUnprocessableEntity)
+		assert.Equal(t, strings.Contains(body, "Password is incorrect"), true)
+	}
+
+	code, headers, body := ts.postForm(t, "/account/2fa/disable", url.Values{"password": {"pa$$word"}, "csrf_token": {csrfToken}})
+	assert.Equal(t, code, http.StatusTooManyRequests)
+	assert.Equal(t, headers.Get("Retry-After"), "30")
+	assert.Equal(t, strings.Contains(body, "Too many failed attempts"), true)
+
+	_, _, body = ts.get(t, "/account/2fa")
+	assert.Equal(t, strings.Contains(body, "Turn off two-factor authentication"), true)
+
+	// The failures count on the login page too.
+	other := newTestServer(t, app.routes())
+	defer other.Close()
+
+	code, _, _ = other.tryLogin(t, "erin@example.com", "pa$$word")
+	assert.Equal(t, code, http.StatusTooManyRequests)
+}
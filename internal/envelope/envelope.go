@@ -0,0 +1,222 @@
+package envelope
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+var (
+	// ErrUnknownKey is returned when data was sealed with a key that isn't in the keyring.
+	ErrUnknownKey = errors.New("envelope: unknown key ID")
+
+	// ErrDecrypt is returned when data can't be decrypted, because it has been tampered
+	// with or the key is wrong.
+	ErrDecrypt = errors.New("envelope: decryption failed")
+)
+
+// A Sealed value is some data encrypted under its own random data key, which is in turn
+// encrypted ("wrapped") under the master key named by KeyID. Rotating the master key only
+// means re-wrapping the small DataKey; the Ciphertext never has to change.
+type Sealed struct {
+	KeyID      string
+	DataKey    []byte
+	Ciphertext []byte
+}
+
+// A Keyring holds the master keys, by ID. New data is always sealed with the current key,
+// which is the one added last; the older keys are only kept to open existing data.
+type Keyring struct {
+	keys    map[string]cipher.AEAD
+	macKeys map[string][]byte // for MAC(), derived from the master keys
+	current string
+}
+
+// macLabel is what the master keys are HMACed with to derive the MAC keys, so that no key
+// is ever used both for encryption and for hashing.
+const macLabel = "snippetbox mac v1"
+
+var keyIDRX = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,32}$`)
+
+// ParseKeyring reads keys in the form "id:base64-key", one per line or separated by commas.
+// Each key must be 32 bytes (AES-256). The last key listed becomes the current one, so
+// rotating means appending a new key to the end.
+func ParseKeyring(s string) (*Keyring, error) {
+	k := &Keyring{keys: map[string]cipher.AEAD{}, macKeys: map[string][]byte{}}
+
+	for _, entry := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == '\n' }) {
+		entry = strings.TrimSpace(entry)
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+
+		id, encoded, ok := strings.Cut(entry, ":")
+		if !ok || !keyIDRX.MatchString(id) {
+			return nil, fmt.Errorf("envelope: malformed key entry %q", id)
+		}
+		if _, exists := k.keys[id]; exists {
+			return nil, fmt.Errorf("envelope: duplicate key ID %q", id)
+		}
+
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(key) != 32 {
+			return nil, fmt.Errorf("envelope: key %q must be 32 bytes of base64", id)
+		}
+
+		aead, err := newAEAD(key)
+		if err != nil {
+			return nil, err
+		}
+
+		derive := hmac.New(sha256.New, key)
+		derive.Write([]byte(macLabel))
+
+		k.keys[id] = aead
+		k.macKeys[id] = derive.Sum(nil)
+		k.current = id
+	}
+
+	if k.current == "" {
+		return nil, errors.New("envelope: no keys found")
+	}
+
+	return k, nil
+}
+
+// LoadKeyring reads the keyring from the file at path or, if path is empty, from the
+// environment variable env. It returns nil and no error if neither is set.
+func LoadKeyring(path, env string) (*Keyring, error) {
+	if path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		return ParseKeyring(string(b))
+	}
+
+	if s := os.Getenv(env); s != "" {
+		return ParseKeyring(s)
+	}
+
+	return nil, nil
+}
+
+// CurrentID returns the ID of the key which new data is sealed with.
+func (k *Keyring) CurrentID() string {
+	return k.current
+}
+
+// Seal encrypts plaintext under a fresh data key, and wraps that under the current key.
+func (k *Keyring) Seal(plaintext []byte) (*Sealed, error) {
+	dataKey := make([]byte, 32)
+	_, err := rand.Read(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	ciphertext, err := seal(aead, plaintext, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// The key ID is authenticated along with the wrapped data key, so a row can't be
+	// pointed at a different master key without it being noticed.
+	wrapped, err := seal(k.keys[k.current], dataKey, []byte(k.current))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Sealed{KeyID: k.current, DataKey: wrapped, Ciphertext: ciphertext}, nil
+}
+
+// MAC returns an HMAC-SHA256 of data under a key derived from the current master key, for
+// recognising equal values without storing something anyone could check a guess against.
+// The result depends on the current key, so values MACed before a rotation have to be
+// MACed again to compare with ones made after it.
+func (k *Keyring) MAC(data []byte) []byte {
+	mac := hmac.New(sha256.New, k.macKeys[k.current])
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+// Open decrypts a sealed value.
+func (k *Keyring) Open(s *Sealed) ([]byte, error) {
+	dataKey, err := k.unwrap(s)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+
+	return open(aead, s.Ciphertext, nil)
+}
+
+// Rewrap returns s with its data key wrapped under the current key instead of whichever
+// key it was sealed with. The ciphertext is left as it is.
+func (k *Keyring) Rewrap(s *Sealed) (*Sealed, error) {
+	dataKey, err := k.unwrap(s)
+	if err != nil {
+		return nil, err
+	}
+
+	wrapped, err := seal(k.keys[k.current], dataKey, []byte(k.current))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Sealed{KeyID: k.current, DataKey: wrapped, Ciphertext: s.Ciphertext}, nil
+}
+
+func (k *Keyring) unwrap(s *Sealed) ([]byte, error) {
+	kek, ok := k.keys[s.KeyID]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	return open(kek, s.DataKey, []byte(s.KeyID))
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts plaintext with a random nonce, which is stored in front of the result.
+func seal(aead cipher.AEAD, plaintext, additional []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	_, err := rand.Read(nonce)
+	if err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, additional), nil
+}
+
+func open(aead cipher.AEAD, data, additional []byte) ([]byte, error) {
+	if len(data) < aead.NonceSize() {
+		return nil, ErrDecrypt
+	}
+
+	plaintext, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], additional)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plaintext, nil
+}
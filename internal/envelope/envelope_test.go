@@ -0,0 +1,117 @@
+package envelope
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"strings"
+	"testing"
+
+	"snippetbox/internal/assert"
+)
+
+const (
+	oldKey = "old:AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA="
+	newKey = "new:AQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQE="
+)
+
+func TestSealOpen(t *testing.T) {
+	k, err := ParseKeyring(oldKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := k.Seal([]byte("password = hunter2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, s.KeyID, "old")
+	assert.Equal(t, strings.Contains(string(s.Ciphertext), "hunter2"), false)
+
+	plaintext, err := k.Open(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, string(plaintext), "password = hunter2")
+
+	// Flipping a bit anywhere must be caught.
+	s.Ciphertext[len(s.Ciphertext)-1] ^= 1
+	_, err = k.Open(s)
+	assert.Equal(t, errors.Is(err, ErrDecrypt), true)
+}
+
+func TestMAC(t *testing.T) {
+	old, _ := ParseKeyring(oldKey)
+	rotated, _ := ParseKeyring(oldKey + "\n" + newKey)
+
+	a := old.MAC([]byte("password = hunter2"))
+
+	// The same data gives the same MAC, and it isn't just the unkeyed hash.
+	sum := sha256.Sum256([]byte("password = hunter2"))
+	assert.Equal(t, bytes.Equal(a, old.MAC([]byte("password = hunter2"))), true)
+	assert.Equal(t, bytes.Equal(a, sum[:]), false)
+	assert.Equal(t, bytes.Equal(a, old.MAC([]byte("password = hunter3"))), false)
+
+	// A new current key means new MACs.
+	assert.Equal(t, bytes.Equal(a, rotated.MAC([]byte("password = hunter2"))), false)
+}
+
+func TestRotation(t *testing.T) {
+	before, _ := ParseKeyring(oldKey)
+	after, err := ParseKeyring(oldKey + "\n" + newKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, after.CurrentID(), "new")
+
+	s, _ := before.Seal([]byte("config"))
+
+	// Data sealed with the old key can still be opened after a new one is added.
+	plaintext, err := after.Open(s)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, string(plaintext), "config")
+
+	rewrapped, err := after.Rewrap(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, rewrapped.KeyID, "new")
+	assert.Equal(t, string(rewrapped.Ciphertext), string(s.Ciphertext))
+
+	plaintext, err = after.Open(rewrapped)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, string(plaintext), "config")
+
+	// Without the new key, the rewrapped data can't be opened.
+	_, err = before.Open(rewrapped)
+	assert.Equal(t, errors.Is(err, ErrUnknownKey), true)
+
+	// Nor can a row be pointed at a different key.
+	rewrapped.KeyID = "old"
+	_, err = after.Open(rewrapped)
+	assert.Equal(t, errors.Is(err, ErrDecrypt), true)
+}
+
+func TestParseKeyring(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		wantErr bool
+	}{
+		{"Single", oldKey, false},
+		{"Comma separated", oldKey + "," + newKey, false},
+		{"Comments and blank lines", "# keys\n\n" + oldKey + "\n", false},
+		{"Empty", "", true},
+		{"No ID", "AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=", true},
+		{"Short key", "old:AAAA", true},
+		{"Duplicate", oldKey + "," + oldKey, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseKeyring(tt.input)
+			assert.Equal(t, err != nil, tt.wantErr)
+		})
+	}
+}
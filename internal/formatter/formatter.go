@@ -0,0 +1,166 @@
+package formatter
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/format"
+	"go/scanner"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// ErrUnsupported is returned by Format for languages it doesn't know how to check.
+var ErrUnsupported = errors.New("formatter: unsupported language")
+
+// A SyntaxError says where content failed to parse. Line and Column start at 1, the same
+// way an editor counts them. Column is 0 when the parser doesn't report one.
+type SyntaxError struct {
+	Line   int
+	Column int
+	Msg    string
+}
+
+func (e *SyntaxError) Error() string {
+	if e.Column == 0 {
+		return fmt.Sprintf("Line %d: %s", e.Line, e.Msg)
+	}
+	return fmt.Sprintf("Line %d, column %d: %s", e.Line, e.Column, e.Msg)
+}
+
+// Languages lists the languages Format supports. Go and JSON are reformatted; YAML and
+// TOML are only checked, and come back as they were.
+var Languages = []string{"Go", "JSON", "TOML", "YAML"}
+
+// Supports reports whether Format can handle language.
+func Supports(language string) bool {
+	for _, l := range Languages {
+		if l == language {
+			return true
+		}
+	}
+	return false
+}
+
+// Format tidies up content written in language, or checks it if there's no standard
+// formatting to apply. Parse errors are returned as a *SyntaxError.
+func Format(language, content string) (string, error) {
+	switch language {
+	case "Go":
+		return formatGo(content)
+	case "JSON":
+		return formatJSON(content)
+	case "TOML":
+		return content, checkTOML(content)
+	case "YAML":
+		return content, checkYAML(content)
+	default:
+		return "", ErrUnsupported
+	}
+}
+
+// formatGo runs gofmt over a whole file or, as gofmt does, a list of declarations or
+// statements.
+func formatGo(content string) (string, error) {
+	b, err := format.Source([]byte(content))
+	if err != nil {
+		var list scanner.ErrorList
+		if errors.As(err, &list) && len(list) > 0 {
+			return "", &SyntaxError{Line: list[0].Pos.Line, Column: list[0].Pos.Column, Msg: list[0].Msg}
+		}
+		return "", err
+	}
+	return string(b), nil
+}
+
+// formatJSON indents JSON with two spaces, keeping the keys in their original order.
+func formatJSON(content string) (string, error) {
+	var buf bytes.Buffer
+
+	// Offsets in errors are counted from the first byte of the trimmed content.
+	trimmed := strings.TrimLeft(content, " \t\r\n")
+	skipped := len(content) - len(trimmed)
+
+	err := json.Indent(&buf, []byte(strings.TrimSpace(trimmed)), "", "  ")
+	if err != nil {
+		var syntaxErr *json.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			// Offset counts the bytes read, up to and including the one that was wrong.
+			line, col := position(content, skipped+int(syntaxErr.Offset)-1)
+			return "", &SyntaxError{Line: line, Column: col, Msg: strings.TrimPrefix(syntaxErr.Error(), "json: ")}
+		}
+		return "", err
+	}
+
+	buf.WriteByte('\n')
+	return buf.String(), nil
+}
+
+// tomlPrefixRX matches the position the toml package puts at the start of some messages,
+// which we report separately.
+var tomlPrefixRX = regexp.MustCompile(`^toml: line \d+( \(last key "[^"]*"\))?: `)
+
+func checkTOML(content string) error {
+	var v map[string]any
+
+	_, err := toml.Decode(content, &v)
+	if err != nil {
+		var parseErr toml.ParseError
+		if errors.As(err, &parseErr) {
+			msg := parseErr.Message
+			if msg == "" {
+				msg = tomlPrefixRX.ReplaceAllString(parseErr.Error(), "")
+			}
+
+			// Not every error comes with an offset. Only trust one that agrees with the line.
+			e := &SyntaxError{Line: parseErr.Position.Line, Msg: msg}
+			if line, col := position(content, parseErr.Position.Start); line == e.Line {
+				e.Column = col
+			}
+			return e
+		}
+		return err
+	}
+	return nil
+}
+
+// yamlErrorRX picks the line number out of yaml.v3's errors, which don't give a column.
+var yamlErrorRX = regexp.MustCompile(`^yaml: line (\d+): (.*)$`)
+
+func checkYAML(content string) error {
+	// A YAML file can hold several documents, separated by "---". Check them all.
+	dec := yaml.NewDecoder(strings.NewReader(content))
+	for {
+		var node yaml.Node
+		err := dec.Decode(&node)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			if m := yamlErrorRX.FindStringSubmatch(err.Error()); m != nil {
+				line, _ := strconv.Atoi(m[1])
+				return &SyntaxError{Line: line, Msg: m[2]}
+			}
+			return &SyntaxError{Line: 1, Msg: strings.TrimPrefix(err.Error(), "yaml: ")}
+		}
+	}
+}
+
+// position converts a byte offset into content to a line and column, counting columns in
+// characters rather than bytes.
+func position(content string, offset int) (int, int) {
+	if offset > len(content) {
+		offset = len(content)
+	}
+
+	before := content[:offset]
+	line := strings.Count(before, "\n") + 1
+	col := len([]rune(before[strings.LastIndex(before, "\n")+1:])) + 1
+	return line, col
+}
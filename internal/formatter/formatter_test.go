@@ -0,0 +1,102 @@
+package formatter
+
+import (
+	"errors"
+	"testing"
+
+	"snippetbox/internal/assert"
+)
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		name     string
+		language string
+		content  string
+		want     string
+		wantErr  string
+	}{
+		{
+			name:     "Go file",
+			language: "Go",
+			content:  "package main\nfunc main(){\nfmt.Println( \"hi\" )\n}",
+			want:     "package main\n\nfunc main() {\n\tfmt.Println(\"hi\")\n}\n",
+		},
+		{
+			name:     "Go statements",
+			language: "Go",
+			content:  "x:=1\nfmt.Println( x )",
+			want:     "x := 1\nfmt.Println(x)",
+		},
+		{
+			name:     "Broken Go",
+			language: "Go",
+			content:  "package main\nfunc main() {\n\tx := \n}\n",
+			wantErr:  "Line 4, column 1: expected operand, found '}'",
+		},
+		{
+			name:     "JSON",
+			language: "JSON",
+			content:  `  {"b":1,"a":[true,null]}`,
+			want:     "{\n  \"b\": 1,\n  \"a\": [\n    true,\n    null\n  ]\n}\n",
+		},
+		{
+			name:     "Broken JSON",
+			language: "JSON",
+			content:  "\n{\"a\": 1,\n \"b\" 2}",
+			wantErr:  "Line 3, column 6: invalid character '2' after object key",
+		},
+		{
+			name:     "Two JSON values",
+			language: "JSON",
+			content:  `{"a":1} {"b":2}`,
+			wantErr:  "Line 1, column 9: invalid character '{' after top-level value",
+		},
+		{
+			name:     "YAML",
+			language: "YAML",
+			content:  "a: 1\nb:\n  - c\n",
+			want:     "a: 1\nb:\n  - c\n",
+		},
+		{
+			name:     "Broken YAML in a later document",
+			language: "YAML",
+			content:  "a: 1\n---\nb: : c\n",
+			wantErr:  "Line 3: mapping values are not allowed in this context",
+		},
+		{
+			name:     "TOML",
+			language: "TOML",
+			content:  "[server]\nport = 4000\n",
+			want:     "[server]\nport = 4000\n",
+		},
+		{
+			name:     "Broken TOML",
+			language: "TOML",
+			content:  "a = \"unterminated\n",
+			wantErr:  "Line 1, column 18: strings cannot contain newlines",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Format(tt.language, tt.content)
+
+			if tt.wantErr != "" {
+				var syntaxErr *SyntaxError
+				assert.Equal(t, errors.As(err, &syntaxErr), true)
+				assert.Equal(t, err.Error(), tt.wantErr)
+				return
+			}
+
+			assert.Equal(t, err, nil)
+			assert.Equal(t, got, tt.want)
+		})
+	}
+}
+
+func TestFormatUnsupported(t *testing.T) {
+	_, err := Format("Python", "print('hi')")
+	assert.Equal(t, errors.Is(err, ErrUnsupported), true)
+	assert.Equal(t, Supports("Python"), false)
+	assert.Equal(t, Supports("TOML"), true)
+}
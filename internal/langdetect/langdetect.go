@@ -0,0 +1,360 @@
+package langdetect
+
+import (
+	"encoding/json"
+	"math"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// A Guess is the language we think some content is written in. Confidence runs from 0 to
+// 1. An empty Language means we couldn't tell.
+type Guess struct {
+	Language   string
+	Confidence float64
+}
+
+// Languages lists every language Detect can return, in the order they're offered to users.
+var Languages = []string{
+	"C", "C#", "C++", "CSS", "Go", "HTML", "Java", "JavaScript", "JSON", "Kotlin",
+	"Markdown", "PHP", "Python", "Ruby", "Rust", "Shell", "SQL", "Swift", "TOML", "TypeScript", "YAML",
+}
+
+// extensions maps file extensions (and a few whole file names) to languages.
+var extensions = map[string]string{
+	".c": "C", ".h": "C",
+	".cs":  "C#",
+	".cpp": "C++", ".cc": "C++", ".cxx": "C++", ".hpp": "C++",
+	".css":  "CSS",
+	".go":   "Go",
+	".html": "HTML", ".htm": "HTML",
+	".java": "Java",
+	".js":   "JavaScript", ".mjs": "JavaScript", ".cjs": "JavaScript", ".jsx": "JavaScript",
+	".json": "JSON",
+	".kt":   "Kotlin", ".kts": "Kotlin",
+	".md": "Markdown", ".markdown": "Markdown",
+	".php": "PHP",
+	".py":  "Python",
+	".rb":  "Ruby", "gemfile": "Ruby", "rakefile": "Ruby",
+	".rs": "Rust",
+	".sh": "Shell", ".bash": "Shell", ".zsh": "Shell", ".bashrc": "Shell", ".profile": "Shell",
+	".sql":   "SQL",
+	".swift": "Swift",
+	".toml":  "TOML",
+	".ts":    "TypeScript", ".tsx": "TypeScript",
+	".yaml": "YAML", ".yml": "YAML",
+}
+
+// interpreters maps the program named on a #! line to a language.
+var interpreters = map[string]string{
+	"sh": "Shell", "bash": "Shell", "zsh": "Shell", "ksh": "Shell", "dash": "Shell",
+	"python": "Python", "python2": "Python", "python3": "Python",
+	"node": "JavaScript", "deno": "TypeScript", "ts-node": "TypeScript",
+	"ruby": "Ruby", "php": "PHP",
+}
+
+// A rule is a pattern that suggests a language. Each match adds weight to the language's
+// score, up to maxMatches matches per rule so that one very repetitive line can't drown
+// out everything else.
+type rule struct {
+	rx     *regexp.Regexp
+	weight float64
+}
+
+const maxMatches = 3
+
+func r(pattern string, weight float64) rule {
+	return rule{regexp.MustCompile(`(?m)` + pattern), weight}
+}
+
+// rules are the keyword and token heuristics for each language. They are deliberately
+// simple: it's enough for the right language to collect more evidence than the others,
+// so a rule can be shared between languages (JavaScript and TypeScript, say) as long as
+// there are others that tell them apart.
+var rules = map[string][]rule{
+	"C": {
+		r(`^#include <\w+\.h>`, 4),
+		r(`\bprintf\(`, 2),
+		r(`\b(malloc|calloc|free|memcpy|strlen)\(`, 3),
+		r(`\btypedef\b`, 3),
+		r(`^(int|void|char|static|unsigned|long) \*?\w+\(.*\)\s*\{?$`, 2),
+		r(`\bNULL\b`, 1),
+	},
+	"C#": {
+		r(`^using System(\.\w+)*;`, 6),
+		r(`\bConsole\.Write(Line)?\(`, 5),
+		r(`\{ get; (private )?set; \}`, 5),
+		r(`\bstatic (async )?(void|int|Task) Main\(`, 5),
+		r(`^namespace [\w.]+`, 1),
+		r(`\b(public|private|internal) (static )?(string|bool|async Task)\b`, 2),
+		r(`\bvar \w+ = new\b`, 1),
+	},
+	"C++": {
+		r(`^#include <\w+>`, 4),
+		r(`\bstd::`, 4),
+		r(`\b(cout|cerr)\s*<<|\bcin\s*>>`, 4),
+		r(`\btemplate\s*<`, 3),
+		r(`^\s*(public|private|protected):\s*$`, 3),
+		r(`\busing namespace\b`, 4),
+		r(`\bnamespace \w+`, 1),
+	},
+	"CSS": {
+		r(`^\s*[.#]?[\w-]+(\s*[,>+~]?\s*[.#:]?[\w-]+)*\s*\{\s*$`, 1),
+		r(`^\s*(color|background(-\w+)?|margin(-\w+)?|padding(-\w+)?|font(-\w+)?|display|width|height|border(-\w+)?|position|top|left|right|bottom|flex(-\w+)?|text-\w+|line-height|z-index|opacity|cursor|overflow|grid(-\w+)?)\s*:\s*[^;]+;`, 3),
+		r(`@media\b|@import url|@keyframes|@font-face`, 4),
+		r(`\b\d+(px|em|rem|vh|vw)\b`, 1),
+		r(`#[0-9a-fA-F]{6}\b|#[0-9a-fA-F]{3}\b`, 1),
+	},
+	"Go": {
+		r(`^package \w+\s*$`, 5),
+		r(`^func (\(\w+ \*?\w+\) )?\w+\(`, 3),
+		r(`:=`, 1),
+		r(`^import (\($|")`, 3),
+		r(`\bfmt\.\w+\(`, 3),
+		r(`\bif err != nil\b`, 4),
+		r(`\bgo func\b|\bchan \w+|\bdefer \w+`, 2),
+		r(`^type \w+ (struct|interface) \{`, 4),
+	},
+	"HTML": {
+		r(`(?i)<!DOCTYPE html>`, 10),
+		r(`(?i)<(html|head|body|div|span|p|a|ul|ol|li|table|form|script|meta|link|h1|h2|section|nav)\b[^>]*>`, 1),
+		r(`(?i)</(html|head|body|div|span|p|a|ul|ol|li|table|form|section|nav|h1|h2)>`, 2),
+	},
+	"Java": {
+		r(`\bpublic static void main\(String\[\] \w+\)`, 5),
+		r(`\bSystem\.(out|err)\.print`, 5),
+		r(`^import [\w.]+(\.\*)?;`, 4),
+		r(`^package [\w.]+;`, 5),
+		r(`@Override\b`, 3),
+		r(`\b(private|public|protected) (static )?(final )?[A-Z]\w*(<[\w, ]+>)? \w+( =|;|\()`, 2),
+		r(`\bString\[\]`, 2),
+		r(`\bnew [A-Z]\w*(<.*>)?\(`, 1),
+	},
+	"JavaScript": {
+		r(`\b(const|let) \w+ = `, 1),
+		r(`\bfunction\s*\w*\s*\(`, 2),
+		r(`=>`, 1),
+		r(`\bconsole\.(log|error|warn)\(`, 3),
+		r(`\bdocument\.\w+|\bwindow\.\w+`, 3),
+		r(`\brequire\(['"]`, 3),
+		r(`\bmodule\.exports\b`, 4),
+		r(`===|!==`, 2),
+		r(`\bimport .* from ['"]`, 1),
+	},
+	"JSON": {
+		r(`^\s*"[^"]+"\s*:\s*("|\d|\{|\[|true|false|null)`, 2),
+	},
+	"Kotlin": {
+		r(`\bfun \w+(<.*>)?\(`, 5),
+		r(`\bval \w+`, 3),
+		r(`(^|[^.\w])println\(`, 2),
+		r(`^import \w+(\.\w+)+$`, 2),
+		r(`^package \w+(\.\w+)+$`, 4),
+		r(`\bdata class\b|\bcompanion object\b|^object \w+`, 4),
+		r(`\?\.|!!\.|\?:`, 2),
+		r(`\bwhen \(`, 3),
+	},
+	"Markdown": {
+		r(`^#{1,6} \S`, 2),
+		r(`\[[^\]]+\]\([^)\s]+\)`, 4),
+		r("^```", 5),
+		r(`\*\*[^*]+\*\*`, 3),
+		r(`^\s*[-*] \S`, 1),
+		r(`^\d+\. \S`, 2),
+		r(`^> \S`, 2),
+	},
+	"PHP": {
+		r(`<\?php`, 10),
+		r(`\$\w+\s*=`, 2),
+		r(`\$this->`, 4),
+		r(`\bfunction \w+\(\$`, 3),
+		r(`\becho\b`, 1),
+	},
+	"Python": {
+		r(`^\s*def \w+\(.*\)( -> [\w\[\], ]+)?:\s*$`, 4),
+		r(`^\s*(from [\w.]+ )?import [\w., ]+$`, 2),
+		r(`^\s*class \w+(\(.*\))?:\s*$`, 4),
+		r(`\bself\.`, 2),
+		r(`\bprint\(`, 1),
+		r(`^\s*(elif .*:|except\b.*:|with .* as \w+:)`, 3),
+		r(`\b(None|True|False)\b`, 1),
+		r(`if __name__ == ['"]__main__['"]`, 5),
+	},
+	"Ruby": {
+		r(`^\s*def \w+[?!]?(\(.*\))?\s*$`, 3),
+		r(`^\s*end\s*$`, 2),
+		r(`\bputs\b`, 2),
+		r(`\bdo \|\w+(, \w+)*\|`, 4),
+		r(`^\s*require(_relative)? ['"]`, 3),
+		r(`\battr_(accessor|reader|writer)\b`, 4),
+		r(`^\s*module [A-Z]\w*\s*$`, 3),
+		r(`^\s*class \w+( < [\w:]+)?\s*$`, 2),
+	},
+	"Rust": {
+		r(`\bfn \w+(<.*>)?\(`, 4),
+		r(`\blet mut\b`, 5),
+		r(`\b(println|format|vec|panic|assert_eq)!`, 5),
+		r(`^\s*use \w+(::[\w{}*, ]+)+;`, 3),
+		r(`\bimpl\b`, 3),
+		r(`&str\b|&mut\b|&self\b`, 3),
+		r(`\bpub (fn|struct|enum)\b`, 3),
+		r(`\bmatch \w+ \{`, 2),
+	},
+	"Shell": {
+		r(`^\s*(echo|export|cd|mkdir|rm|cp|mv|sudo|apt-get|grep|chmod|curl|source) `, 2),
+		r(`\$\{\w+|"\$\w+"|\$\(`, 2),
+		r(`^\s*if \[\[? .*\]\]?; then`, 6),
+		r(`^\s*(fi|done|esac)\s*$`, 5),
+		r(`^\s*\w+=["$(\w]`, 2),
+		r(`\|\s*(grep|awk|sed|xargs|sort|uniq|head|tail|wc)\b`, 3),
+		r(`^\s*(for|while) .*; do\s*$`, 5),
+	},
+	"SQL": {
+		r(`(?i)\bSELECT\b.*\bFROM\b`, 4),
+		r(`(?i)\bINSERT INTO\b`, 5),
+		r(`(?i)\bCREATE (TABLE|INDEX|VIEW)\b`, 5),
+		r(`(?i)\bUPDATE \w+ SET\b`, 5),
+		r(`(?i)\bWHERE\b`, 1),
+		r(`(?i)\b(INNER|LEFT|RIGHT|OUTER) JOIN\b`, 3),
+		r(`(?i)\bPRIMARY KEY\b|\bFOREIGN KEY\b`, 3),
+		r(`(?i)\bVARCHAR\(|\bINTEGER NOT NULL\b`, 3),
+		r(`(?i)\b(GROUP|ORDER) BY\b`, 2),
+	},
+	"Swift": {
+		r(`^import (Foundation|UIKit|SwiftUI|Combine)\s*$`, 6),
+		r(`\bfunc \w+(<.*>)?\(.*\)( (async |throws )*-> [\w?\[\]]+)?\s*\{`, 2),
+		r(`\bvar \w+: [\w?\[\]]+`, 2),
+		r(`\b(guard|if) let\b`, 5),
+		r(`\\\(\w+`, 4),
+		r(`\b(struct|class|enum|extension) \w+: \w+`, 3),
+		r(`@(IBOutlet|IBAction|State|Published|objc|main)\b`, 4),
+		r(`\blet \w+(: [\w?]+)? = `, 1),
+	},
+	"TOML": {
+		r(`^\[\[?[\w.-]+\]\]?\s*$`, 3),
+		r(`^[\w.-]+ = ("|'|\d|\[|\{|true\b|false\b)`, 2),
+	},
+	"TypeScript": {
+		r(`:\s*(string|number|boolean|any|void|unknown|never)\b`, 3),
+		r(`^\s*(export )?interface \w+(<.*>)?\s*\{`, 4),
+		r(`^\s*(export )?type \w+(<.*>)? = `, 4),
+		r(`\bas (string|number|any|const|unknown)\b`, 2),
+		r(`\b(private|public|readonly) \w+:`, 3),
+		r(`\bimport .* from ['"]`, 1),
+		r(`===|!==`, 1),
+		r(`\b(const|let) \w+: \w+`, 3),
+	},
+	"YAML": {
+		r(`^[\w-]+:\s*$`, 2),
+		r(`^\s*[\w-]+: [^\s{;][^;{]*$`, 2),
+		r(`^\s*- [\w"'$]`, 2),
+		r(`^---\s*$`, 2),
+	},
+}
+
+// nameRX picks out file names from a title like "Fixing main.go".
+var nameRX = regexp.MustCompile(`[\w.-]*\w`)
+
+// Detect guesses the language of content. name can be a file name or a title which
+// contains one, and is used as a hint. A #! line is trusted first, then a recognised file
+// extension, and otherwise the content is scored against each language's heuristics.
+func Detect(name, content string) Guess {
+	if lang, ok := fromShebang(content); ok {
+		return Guess{Language: lang, Confidence: 0.99}
+	}
+
+	if lang, ok := fromName(name); ok {
+		return Guess{Language: lang, Confidence: 0.95}
+	}
+
+	return fromContent(content)
+}
+
+func fromShebang(content string) (string, bool) {
+	if !strings.HasPrefix(content, "#!") {
+		return "", false
+	}
+
+	line, _, _ := strings.Cut(content[2:], "\n")
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return "", false
+	}
+
+	// "#!/usr/bin/env python3" names the interpreter in its second field.
+	prog := path.Base(fields[0])
+	if prog == "env" && len(fields) > 1 {
+		prog = fields[len(fields)-1]
+	}
+
+	lang, ok := interpreters[prog]
+	return lang, ok
+}
+
+func fromName(name string) (string, bool) {
+	for _, word := range nameRX.FindAllString(strings.ToLower(name), -1) {
+		if lang, ok := extensions[word]; ok {
+			return lang, true
+		}
+		if ext := path.Ext(word); ext != "" && ext != word {
+			if lang, ok := extensions[ext]; ok {
+				return lang, true
+			}
+		}
+	}
+	return "", false
+}
+
+// minScore is the least evidence we need before we'll guess at all.
+const minScore = 4
+
+func fromContent(content string) Guess {
+	trimmed := strings.TrimSpace(content)
+	if trimmed == "" {
+		return Guess{}
+	}
+
+	// Anything that parses as a JSON object or array is JSON, whatever else it looks like.
+	if (trimmed[0] == '{' || trimmed[0] == '[') && json.Valid([]byte(trimmed)) {
+		return Guess{Language: "JSON", Confidence: 0.95}
+	}
+
+	type score struct {
+		lang  string
+		total float64
+	}
+
+	scores := make([]score, 0, len(rules))
+	for lang, rs := range rules {
+		var total float64
+		for _, rl := range rs {
+			n := len(rl.rx.FindAllStringIndex(content, maxMatches))
+			total += float64(n) * rl.weight
+		}
+		scores = append(scores, score{lang, total})
+	}
+
+	// Sort by score, then by name so that ties come out the same way every time.
+	sort.Slice(scores, func(i, j int) bool {
+		if scores[i].total != scores[j].total {
+			return scores[i].total > scores[j].total
+		}
+		return scores[i].lang < scores[j].lang
+	})
+
+	best, next := scores[0], scores[1]
+	if best.total < minScore {
+		return Guess{}
+	}
+
+	// Confidence combines how far ahead of the runner-up the best language is with how
+	// much evidence there was in total, so a narrow win on a two-line snippet doesn't come
+	// out looking certain.
+	margin := best.total / (best.total + next.total)
+	evidence := math.Min(1, best.total/20)
+	confidence := math.Round(margin*(0.5+0.5*evidence)*100) / 100
+
+	return Guess{Language: best.lang, Confidence: confidence}
+}
@@ -0,0 +1,85 @@
+package langdetect
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"snippetbox/internal/assert"
+)
+
+// TestCorpus checks a sample of each language in testdata/corpus is recognised from its
+// content alone, without a file name to help.
+func TestCorpus(t *testing.T) {
+	files := map[string]string{
+		"c.txt":          "C",
+		"csharp.txt":     "C#",
+		"cpp.txt":        "C++",
+		"css.txt":        "CSS",
+		"go.txt":         "Go",
+		"html.txt":       "HTML",
+		"java.txt":       "Java",
+		"javascript.txt": "JavaScript",
+		"json.txt":       "JSON",
+		"kotlin.txt":     "Kotlin",
+		"markdown.txt":   "Markdown",
+		"php.txt":        "PHP",
+		"python.txt":     "Python",
+		"ruby.txt":       "Ruby",
+		"rust.txt":       "Rust",
+		"shell.txt":      "Shell",
+		"sql.txt":        "SQL",
+		"swift.txt":      "Swift",
+		"toml.txt":       "TOML",
+		"typescript.txt": "TypeScript",
+		"yaml.txt":       "YAML",
+	}
+
+	// Every language we claim to support should have a sample.
+	assert.Equal(t, len(files), len(Languages))
+
+	for file, want := range files {
+		t.Run(want, func(t *testing.T) {
+			content, err := os.ReadFile(filepath.Join("testdata", "corpus", file))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			guess := Detect("", string(content))
+
+			assert.Equal(t, guess.Language, want)
+			if guess.Confidence < 0.5 || guess.Confidence > 1 {
+				t.Errorf("confidence %.2f out of range", guess.Confidence)
+			}
+		})
+	}
+}
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name     string
+		title    string
+		content  string
+		wantLang string
+		wantConf float64
+	}{
+		{"Shebang", "", "#!/bin/bash\nls", "Shell", 0.99},
+		{"Env shebang", "", "#!/usr/bin/env python3\nx = 1", "Python", 0.99},
+		{"Shebang beats name", "script.rb", "#!/usr/bin/env node\nx()", "JavaScript", 0.99},
+		{"File name", "main.go", "x", "Go", 0.95},
+		{"File name in title", "Fixing the index.HTML layout", "x", "HTML", 0.95},
+		{"Whole file name", "Gemfile", "x", "Ruby", 0.95},
+		{"Unknown shebang", "", "#!/usr/bin/awk -f\n{ print }", "", 0},
+		{"Plain text", "Shopping list", "eggs, milk and bread", "", 0},
+		{"Empty", "", "", "", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			guess := Detect(tt.title, tt.content)
+
+			assert.Equal(t, guess.Language, tt.wantLang)
+			assert.Equal(t, guess.Confidence, tt.wantConf)
+		})
+	}
+}
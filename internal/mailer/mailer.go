@@ -0,0 +1,114 @@
+package mailer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrHeaderInjection is returned for a message with a line break in one of its headers,
+// which would otherwise let whoever chose the text add headers (or a body) of their own.
+var ErrHeaderInjection = errors.New("mailer: line break in header")
+
+// A Message is a plain text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer is implemented by anything which can deliver a Message. The application only
+// depends on this interface, so the backend can be swapped on the command line: SMTP in
+// production, a directory of .eml files when running locally.
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// SMTPMailer delivers messages through an SMTP server. If Username is empty no
+// authentication is attempted.
+type SMTPMailer struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	Sender   string
+}
+
+func (m *SMTPMailer) Send(msg Message) error {
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+
+	b, err := format(m.Sender, msg, time.Now())
+	if err != nil {
+		return err
+	}
+
+	addr := fmt.Sprintf("%s:%d", m.Host, m.Port)
+	return smtp.SendMail(addr, auth, m.Sender, []string{msg.To}, b)
+}
+
+// DirMailer writes each message to its own .eml file in Dir instead of sending it, so you
+// can read the mail the application would have sent with any mail client or text editor.
+type DirMailer struct {
+	Dir    string
+	Sender string
+}
+
+func (m *DirMailer) Send(msg Message) error {
+	now := time.Now()
+
+	b, err := format(m.Sender, msg, now)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(m.Dir, 0o755)
+	if err != nil {
+		return err
+	}
+
+	// Name the files so that they sort in the order they were sent.
+	name := fmt.Sprintf("%s-%s.eml", now.UTC().Format("20060102T150405.000000000"), safeName(msg.To))
+
+	return os.WriteFile(filepath.Join(m.Dir, name), b, 0o644)
+}
+
+// format renders a message in RFC 5322 form, ready to be handed to an SMTP server. It
+// returns ErrHeaderInjection rather than write a header value containing a line break.
+func format(sender string, msg Message, date time.Time) ([]byte, error) {
+	for _, v := range []string{sender, msg.To, msg.Subject} {
+		if strings.ContainsAny(v, "\r\n") {
+			return nil, ErrHeaderInjection
+		}
+	}
+
+	var b bytes.Buffer
+
+	fmt.Fprintf(&b, "From: %s\r\n", sender)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", msg.Subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+
+	return b.Bytes(), nil
+}
+
+// safeName strips anything from an email address which might not be allowed in a file name.
+func safeName(s string) string {
+	return strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '.' || r == '-' || r == '@' {
+			return r
+		}
+		return '_'
+	}, s)
+}
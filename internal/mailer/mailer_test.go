@@ -0,0 +1,57 @@
+package mailer
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"snippetbox/internal/assert"
+	"strings"
+	"testing"
+)
+
+func TestDirMailer(t *testing.T) {
+	dir := t.TempDir()
+
+	m := &DirMailer{Dir: filepath.Join(dir, "mail"), Sender: "Snippetbox <no-reply@example.com>"}
+
+	err := m.Send(Message{
+		To:      "alice@example.com",
+		Subject: "Hello",
+		Body:    "Line one\nLine two",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := os.ReadDir(m.Dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, len(files), 1)
+	assert.Equal(t, strings.HasSuffix(files[0].Name(), "-alice@example.com.eml"), true)
+
+	b, err := os.ReadFile(filepath.Join(m.Dir, files[0].Name()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := string(b)
+	assert.Equal(t, strings.Contains(msg, "To: alice@example.com\r\n"), true)
+	assert.Equal(t, strings.Contains(msg, "Subject: Hello\r\n"), true)
+	assert.Equal(t, strings.HasSuffix(msg, "\r\n\r\nLine one\r\nLine two"), true)
+}
+
+func TestDirMailerHeaderInjection(t *testing.T) {
+	m := &DirMailer{Dir: filepath.Join(t.TempDir(), "mail"), Sender: "Snippetbox <no-reply@example.com>"}
+
+	err := m.Send(Message{
+		To:      "alice@example.com",
+		Subject: "Hello\r\nBcc: x@y",
+		Body:    "Line one",
+	})
+	assert.Equal(t, errors.Is(err, ErrHeaderInjection), true)
+
+	// Nothing was written.
+	_, err = os.Stat(m.Dir)
+	assert.Equal(t, os.IsNotExist(err), true)
+}
@@ -0,0 +1,133 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// The permissions a snippet's owner can grant to other users. Edit includes view.
+// PermissionOwner can't be granted: it's what the snippet's creator has, and lets them
+// change who else has access.
+const (
+	PermissionView  = "view"
+	PermissionEdit  = "edit"
+	PermissionOwner = "owner"
+)
+
+// A Grant gives one user access to one snippet. Name and Email are the user's, for
+// showing on the sharing panel.
+type Grant struct {
+	SnippetID  int
+	UserID     int
+	Name       string
+	Email      string
+	Permission string
+	Created    time.Time
+}
+
+type ACLModelInterface interface {
+	Grant(snippetID int, email string, permission string) error
+	Revoke(snippetID, userID int) error
+	Permission(snippetID, userID int) (string, error)
+	ForSnippet(snippetID int) ([]*Grant, error)
+}
+
+// ACLModel wraps the snippet_acl table, which lists who besides its owner has access to
+// each snippet.
+type ACLModel struct {
+	DB *sql.DB
+}
+
+// Grant gives the user with the given email address permission on a snippet, replacing
+// whatever permission they had before. It returns ErrNoRecord if there is no such user,
+// or if they're the snippet's owner (who has every permission already).
+func (m *ACLModel) Grant(snippetID int, email string, permission string) error {
+	if permission != PermissionView && permission != PermissionEdit {
+		return ErrInvalidPermission
+	}
+
+	stmt := `INSERT INTO snippet_acl (snippet_id, user_id, permission, created)
+    		SELECT ?, u.id, ?, UTC_TIMESTAMP() FROM users u
+    		WHERE u.email = ? AND u.id <> (SELECT IFNULL(user_id, 0) FROM snippets WHERE id = ?)
+    		ON DUPLICATE KEY UPDATE permission = VALUES(permission)`
+
+	result, err := m.DB.Exec(stmt, snippetID, permission, email, snippetID)
+	if err != nil {
+		return err
+	}
+
+	// MySQL reports 0 rows affected both when nobody matched and when the user already had
+	// exactly this permission, so check which it was.
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		var exists bool
+		stmt = `SELECT EXISTS(SELECT true FROM snippet_acl a INNER JOIN users u ON u.id = a.user_id
+        		WHERE a.snippet_id = ? AND u.email = ?)`
+		err = m.DB.QueryRow(stmt, snippetID, email).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return ErrNoRecord
+		}
+	}
+
+	return nil
+}
+
+// Revoke removes a user's access to a snippet. Revoking access they don't have isn't an
+// error.
+func (m *ACLModel) Revoke(snippetID, userID int) error {
+	_, err := m.DB.Exec("DELETE FROM snippet_acl WHERE snippet_id = ? AND user_id = ?", snippetID, userID)
+	return err
+}
+
+// Permission returns the permission a user has been granted on a snippet, or "" if they
+// haven't been granted any. It knows nothing about owners: check Snippet.UserID for that.
+func (m *ACLModel) Permission(snippetID, userID int) (string, error) {
+	var permission string
+
+	err := m.DB.QueryRow("SELECT permission FROM snippet_acl WHERE snippet_id = ? AND user_id = ?", snippetID, userID).Scan(&permission)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", nil
+		}
+		return "", err
+	}
+
+	return permission, nil
+}
+
+// ForSnippet lists everybody who has been given access to a snippet, by name.
+func (m *ACLModel) ForSnippet(snippetID int) ([]*Grant, error) {
+	stmt := `SELECT a.snippet_id, a.user_id, u.name, u.email, a.permission, a.created
+    		FROM snippet_acl a INNER JOIN users u ON u.id = a.user_id
+    		WHERE a.snippet_id = ? ORDER BY u.name, u.id`
+
+	rows, err := m.DB.Query(stmt, snippetID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	grants := []*Grant{}
+
+	for rows.Next() {
+		g := &Grant{}
+		err = rows.Scan(&g.SnippetID, &g.UserID, &g.Name, &g.Email, &g.Permission, &g.Created)
+		if err != nil {
+			return nil, err
+		}
+		grants = append(grants, g)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return grants, nil
+}
@@ -12,4 +12,26 @@ var (
 	// Add a new ErrDuplicateEmail error. We'll use this later if a user
 	// tries to login with an incorrect email address or password
 	ErrDuplicateEmail = errors.New("models: duplicate email")
+
+	// ErrDuplicateAlias is returned when a snippet alias has already been claimed.
+	ErrDuplicateAlias = errors.New("models: duplicate alias")
+
+	// ErrAccountSuspended is returned by Authenticate when the credentials are
+	// correct but a moderator has suspended the account.
+	ErrAccountSuspended = errors.New("models: account suspended")
+
+	// ErrInvalidAction is returned when a moderator asks for an action we don't know about.
+	ErrInvalidAction = errors.New("models: invalid moderation action")
+
+	// ErrInvalidPermission is returned when asked to grant a permission which can't be shared.
+	ErrInvalidPermission = errors.New("models: invalid permission")
+
+	// ErrDuplicateSlug is returned when an organization's URL name is already taken.
+	ErrDuplicateSlug = errors.New("models: duplicate slug")
+
+	// ErrLastOwner is returned when a change would leave an organization without an owner.
+	ErrLastOwner = errors.New("models: organization needs an owner")
+
+	// ErrNoKeys is returned when something has to be encrypted but no keys are loaded.
+	ErrNoKeys = errors.New("models: no encryption keys loaded")
 )
@@ -0,0 +1,78 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Failed logins are counted against both the account they were for and the address they
+// came from: the first slows down guessing one user's password, the second slows down
+// trying one password against lots of users.
+const (
+	AttemptScopeAccount = "account"
+	AttemptScopeIP      = "ip"
+)
+
+// Password reset requests are counted the same way, by the address the link is sent to
+// and the address the request came from, so that nobody can flood an inbox with them.
+const (
+	AttemptScopeResetEmail = "reset-email"
+	AttemptScopeResetIP    = "reset-ip"
+)
+
+type LoginAttemptModelInterface interface {
+	Failures(scope, key string, window time.Duration) (int, time.Time, error)
+	Fail(scope, key string, window time.Duration) error
+	Reset(scope, key string) error
+}
+
+// LoginAttemptModel keeps count of failed logins in the database, so that the counts
+// survive restarts and are shared by every instance of the application. Keys are email
+// addresses or IP addresses, depending on the scope. Emails are counted whether or not
+// anybody has signed up with them, so that the limits behave the same either way.
+type LoginAttemptModel struct {
+	DB *sql.DB
+}
+
+// Failures returns how many logins have failed for the key, and when the last one was.
+// Failures stop counting once there haven't been any for the length of window.
+func (m *LoginAttemptModel) Failures(scope, key string, window time.Duration) (int, time.Time, error) {
+	var failures int
+	var lastFailure time.Time
+
+	stmt := `SELECT failures, last_failure FROM login_attempts
+    		WHERE scope = ? AND attempt_key = ? AND last_failure > DATE_SUB(UTC_TIMESTAMP(), INTERVAL ? SECOND)`
+
+	err := m.DB.QueryRow(stmt, scope, key, int(window.Seconds())).Scan(&failures, &lastFailure)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, time.Time{}, nil
+		}
+		return 0, time.Time{}, err
+	}
+
+	return failures, lastFailure, nil
+}
+
+// Fail records a failed login for the key. If the last one was longer ago than window,
+// the count starts again from one. It's a single statement, so failures happening at the
+// same time on different instances are all counted.
+func (m *LoginAttemptModel) Fail(scope, key string, window time.Duration) error {
+	stmt := `INSERT INTO login_attempts (scope, attempt_key, failures, last_failure)
+    		VALUES (?, ?, 1, UTC_TIMESTAMP())
+    		ON DUPLICATE KEY UPDATE
+    			failures = IF(last_failure > DATE_SUB(UTC_TIMESTAMP(), INTERVAL ? SECOND), failures + 1, 1),
+    			last_failure = UTC_TIMESTAMP()`
+
+	_, err := m.DB.Exec(stmt, scope, key, int(window.Seconds()))
+	return err
+}
+
+// Reset forgets the failures for the key, after a successful login.
+func (m *LoginAttemptModel) Reset(scope, key string) error {
+	stmt := "DELETE FROM login_attempts WHERE scope = ? AND attempt_key = ?"
+
+	_, err := m.DB.Exec(stmt, scope, key)
+	return err
+}
@@ -0,0 +1,51 @@
+package mocks
+
+import (
+	"snippetbox/internal/models"
+	"time"
+)
+
+// Bob (user 2) can edit mockSnippet, and has been shown mockScheduledSnippet before it's
+// published.
+var mockGrants = []*models.Grant{
+	{SnippetID: 1, UserID: 2, Name: "Bob", Email: "bob@example.com", Permission: models.PermissionEdit, Created: time.Now()},
+	{SnippetID: 3, UserID: 2, Name: "Bob", Email: "bob@example.com", Permission: models.PermissionView, Created: time.Now()},
+}
+
+type ACLModel struct{}
+
+func (m *ACLModel) Grant(snippetID int, email string, permission string) error {
+	if permission != models.PermissionView && permission != models.PermissionEdit {
+		return models.ErrInvalidPermission
+	}
+
+	switch email {
+	case "bob@example.com":
+		return nil
+	default:
+		return models.ErrNoRecord
+	}
+}
+
+func (m *ACLModel) Revoke(snippetID, userID int) error {
+	return nil
+}
+
+func (m *ACLModel) Permission(snippetID, userID int) (string, error) {
+	for _, g := range mockGrants {
+		if g.SnippetID == snippetID && g.UserID == userID {
+			return g.Permission, nil
+		}
+	}
+	return "", nil
+}
+
+func (m *ACLModel) ForSnippet(snippetID int) ([]*models.Grant, error) {
+	grants := []*models.Grant{}
+	for _, g := range mockGrants {
+		if g.SnippetID == snippetID {
+			grants = append(grants, g)
+		}
+	}
+	return grants, nil
+}
@@ -0,0 +1,51 @@
+package mocks
+
+import (
+	"time"
+)
+
+// Like TokenModel, LoginAttemptModel remembers what it's told, so that tests can run
+// into the limits.
+type LoginAttemptModel struct {
+	attempts map[attemptKey]*mockAttempts
+}
+
+type attemptKey struct {
+	scope string
+	key   string
+}
+
+type mockAttempts struct {
+	failures    int
+	lastFailure time.Time
+}
+
+func (m *LoginAttemptModel) Failures(scope, key string, window time.Duration) (int, time.Time, error) {
+	a, ok := m.attempts[attemptKey{scope, key}]
+	if !ok || time.Since(a.lastFailure) > window {
+		return 0, time.Time{}, nil
+	}
+
+	return a.failures, a.lastFailure, nil
+}
+
+func (m *LoginAttemptModel) Fail(scope, key string, window time.Duration) error {
+	if m.attempts == nil {
+		m.attempts = make(map[attemptKey]*mockAttempts)
+	}
+
+	a, ok := m.attempts[attemptKey{scope, key}]
+	if !ok || time.Since(a.lastFailure) > window {
+		a = &mockAttempts{}
+		m.attempts[attemptKey{scope, key}] = a
+	}
+
+	a.failures++
+	a.lastFailure = time.Now()
+	return nil
+}
+
+func (m *LoginAttemptModel) Reset(scope, key string) error {
+	delete(m.attempts, attemptKey{scope, key})
+	return nil
+}
@@ -0,0 +1,123 @@
+package mocks
+
+import (
+	"snippetbox/internal/models"
+	"time"
+)
+
+// Alice owns Acme, and Bob is a member. There's an invitation waiting for Alice to join
+// Globex, with the token "globex-invite".
+var mockOrg = &models.Org{
+	ID:      1,
+	Name:    "Acme",
+	Slug:    "acme",
+	Created: time.Now(),
+}
+
+var mockMembers = []*models.Member{
+	{UserID: 1, Name: "Alice", Email: "alice@example.com", Role: models.RoleOwner, Joined: time.Now()},
+	{UserID: 2, Name: "Bob", Email: "bob@example.com", Role: models.RoleMember, Joined: time.Now()},
+}
+
+var mockInvitation = &models.Invitation{
+	ID:      1,
+	OrgID:   2,
+	OrgName: "Globex",
+	OrgSlug: "globex",
+	Email:   "alice@example.com",
+	Role:    models.RoleMember,
+	Created: time.Now(),
+	Expires: time.Now().Add(7 * 24 * time.Hour),
+}
+
+type OrgModel struct{}
+
+func (m *OrgModel) Insert(name, slug string, ownerID int) (int, error) {
+	switch slug {
+	case "acme":
+		return 0, models.ErrDuplicateSlug
+	default:
+		return 3, nil
+	}
+}
+
+func (m *OrgModel) GetBySlug(slug string) (*models.Org, error) {
+	switch slug {
+	case "acme":
+		return mockOrg, nil
+	default:
+		return nil, models.ErrNoRecord
+	}
+}
+
+func (m *OrgModel) Role(orgID, userID int) (string, error) {
+	if orgID != mockOrg.ID {
+		return "", nil
+	}
+	for _, mb := range mockMembers {
+		if mb.UserID == userID {
+			return mb.Role, nil
+		}
+	}
+	return "", nil
+}
+
+func (m *OrgModel) ForUser(userID int) ([]*models.Membership, error) {
+	memberships := []*models.Membership{}
+	for _, mb := range mockMembers {
+		if mb.UserID == userID {
+			memberships = append(memberships, &models.Membership{OrgID: mockOrg.ID, Name: mockOrg.Name, Slug: mockOrg.Slug, Role: mb.Role})
+		}
+	}
+	return memberships, nil
+}
+
+func (m *OrgModel) Members(orgID int) ([]*models.Member, error) {
+	if orgID != mockOrg.ID {
+		return []*models.Member{}, nil
+	}
+	return mockMembers, nil
+}
+
+func (m *OrgModel) SetRole(orgID, userID int, role string) error {
+	switch userID {
+	case 1:
+		if role != models.RoleOwner {
+			return models.ErrLastOwner
+		}
+		return nil
+	case 2:
+		return nil
+	default:
+		return models.ErrNoRecord
+	}
+}
+
+func (m *OrgModel) RemoveMember(orgID, userID int) error {
+	if userID == 1 {
+		return models.ErrLastOwner
+	}
+	return nil
+}
+
+func (m *OrgModel) Invite(orgID int, email, role, token string, expires time.Time) error {
+	return nil
+}
+
+func (m *OrgModel) Invitations(orgID int) ([]*models.Invitation, error) {
+	return []*models.Invitation{}, nil
+}
+
+func (m *OrgModel) GetInvitation(token string) (*models.Invitation, error) {
+	if token == "globex-invite" {
+		return mockInvitation, nil
+	}
+	return nil, models.ErrNoRecord
+}
+
+func (m *OrgModel) AcceptInvitation(token string, userID int) (*models.Invitation, error) {
+	if token == "globex-invite" && userID == 1 {
+		return mockInvitation, nil
+	}
+	return nil, models.ErrNoRecord
+}
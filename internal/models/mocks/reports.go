@@ -0,0 +1,43 @@
+package mocks
+
+import (
+	"snippetbox/internal/models"
+	"time"
+)
+
+var mockReport = &models.Report{
+	ID:           1,
+	SnippetID:    1,
+	SnippetTitle: "An old silent pond",
+	AuthorID:     1,
+	ReporterID:   1,
+	Reason:       "Spam",
+	Created:      time.Now(),
+}
+
+type ReportModel struct{}
+
+func (m *ReportModel) Insert(snippetID, reporterID int, reason string) error {
+	return nil
+}
+
+func (m *ReportModel) Open() ([]*models.Report, error) {
+	return []*models.Report{mockReport}, nil
+}
+
+func (m *ReportModel) Resolve(id, moderatorID int, action string) error {
+	if id != mockReport.ID {
+		return models.ErrNoRecord
+	}
+
+	switch action {
+	case models.ModerationDismiss, models.ModerationHide, models.ModerationSuspend:
+		return nil
+	default:
+		return models.ErrInvalidAction
+	}
+}
+
+func (m *ReportModel) RecentActions() ([]*models.ModerationAction, error) {
+	return []*models.ModerationAction{}, nil
+}
@@ -2,23 +2,102 @@ package mocks
 
 import (
 	"database/sql"
+	"errors"
 	"snippetbox/internal/models"
 	"time"
 )
 
 var mockSnippet = &models.Snippet{
-	ID:      1,
-	Title:   "An old silent pond",
-	Content: "with an old rusted sword in it",
-	Created: time.Now(),
-	Expires: time.Now(),
+	ID:                 1,
+	Title:              "An old silent pond",
+	Content:            "with an old rusted sword in it",
+	Created:            time.Now().Add(-48 * time.Hour),
+	Updated:            time.Now().Add(-24 * time.Hour),
+	Expires:            time.Now(),
+	PublishAt:          time.Now(),
+	UserID:             1,
+	Hash:               models.ContentHash("with an old rusted sword in it"),
+	Author:             "Alice",
+	Language:           "Go",
+	LanguageConfidence: 0.8,
+	Tags:               []string{"haiku", "poetry"},
+}
+
+// mockEncryptedSnippet was encrypted in the browser, so all we have is ciphertext.
+var mockEncryptedSnippet = &models.Snippet{
+	ID:              4,
+	Title:           "Production credentials",
+	Content:         "v1:q83vEjRWeJq83vEjRWeJq83vEjRWeJq83vEjRWeJ",
+	Created:         time.Now(),
+	Expires:         time.Now().Add(7 * 24 * time.Hour),
+	PublishAt:       time.Now(),
+	UserID:          1,
+	Hash:            models.ContentHash("v1:q83vEjRWeJq83vEjRWeJq83vEjRWeJq83vEjRWeJ"),
+	Author:          "Alice",
+	ClientEncrypted: true,
+}
+
+// mockScheduledSnippet belongs to user 1 and isn't due to be published until tomorrow.
+var mockScheduledSnippet = &models.Snippet{
+	ID:        3,
+	Title:     "Postmortem",
+	Content:   "What went wrong",
+	Created:   time.Now(),
+	Expires:   time.Now().Add(8 * 24 * time.Hour),
+	UserID:    1,
+	Hash:      models.ContentHash("What went wrong"),
+	PublishAt: time.Now().Add(24 * time.Hour),
+}
+
+// mockOrgSnippet was posted to the Acme organization by Bob, so only Acme's members can
+// see it.
+var mockOrgSnippet = &models.Snippet{
+	ID:        5,
+	Title:     "Deploy checklist",
+	Content:   "Tag the release, then run the migrations",
+	Created:   time.Now(),
+	Expires:   time.Now().Add(365 * 24 * time.Hour),
+	PublishAt: time.Now(),
+	UserID:    2,
+	Hash:      models.ContentHash("Tag the release, then run the migrations"),
+	Author:    "Bob",
+	OrgID:     1,
+}
+
+// mockOrgRunbook was posted to Acme by Alice. Bob is only a member of Acme, so he can read
+// it but not change it.
+var mockOrgRunbook = &models.Snippet{
+	ID:        7,
+	Title:     "Incident runbook",
+	Content:   "Page whoever is on call",
+	Created:   time.Now(),
+	Expires:   time.Now().Add(365 * 24 * time.Hour),
+	PublishAt: time.Now(),
+	UserID:    1,
+	Hash:      models.ContentHash("Page whoever is on call"),
+	Author:    "Alice",
+	OrgID:     1,
+}
+
+// mockNoindexSnippet is one of Alice's, and she has asked search engines to skip it.
+var mockNoindexSnippet = &models.Snippet{
+	ID:        6,
+	Title:     "Home network notes",
+	Content:   "The printer is at 192.168.1.20",
+	Created:   time.Now(),
+	Expires:   time.Now().Add(365 * 24 * time.Hour),
+	PublishAt: time.Now(),
+	UserID:    1,
+	Hash:      models.ContentHash("The printer is at 192.168.1.20"),
+	Author:    "Alice",
+	Noindex:   true,
 }
 
 type SnippetModel struct {
 	DB *sql.DB
 }
 
-func (m *SnippetModel) Insert(title string, content string, expires int) (int, error) {
+func (m *SnippetModel) Insert(title string, content string, expires int, userID int, publishAt time.Time, noindex bool, language string, confidence float64, clientEncrypted bool, orgID int) (int, error) {
 	return 2, nil
 }
 
@@ -26,6 +105,16 @@ func (m *SnippetModel) Get(id int) (*models.Snippet, error) {
 	switch id {
 	case 1:
 		return mockSnippet, nil
+	case 3:
+		return mockScheduledSnippet, nil
+	case 4:
+		return mockEncryptedSnippet, nil
+	case 5:
+		return mockOrgSnippet, nil
+	case 6:
+		return mockNoindexSnippet, nil
+	case 7:
+		return mockOrgRunbook, nil
 	default:
 		return nil, models.ErrNoRecord
 	}
@@ -34,3 +123,179 @@ func (m *SnippetModel) Get(id int) (*models.Snippet, error) {
 func (m *SnippetModel) Latest() ([]*models.Snippet, error) {
 	return []*models.Snippet{mockSnippet}, nil
 }
+
+func (m *SnippetModel) LatestByUser(userID int) ([]*models.Snippet, error) {
+	if userID == mockSnippet.UserID {
+		return []*models.Snippet{mockSnippet}, nil
+	}
+	return []*models.Snippet{}, nil
+}
+
+func (m *SnippetModel) LatestByTag(tag string) ([]*models.Snippet, error) {
+	for _, t := range mockSnippet.Tags {
+		if t == tag {
+			return []*models.Snippet{mockSnippet}, nil
+		}
+	}
+	return []*models.Snippet{}, nil
+}
+
+func (m *SnippetModel) ByOrg(orgID int, offset, limit int) ([]*models.Snippet, error) {
+	if orgID == mockOrgSnippet.OrgID && offset == 0 && limit > 0 {
+		return []*models.Snippet{mockOrgSnippet}, nil
+	}
+	return []*models.Snippet{}, nil
+}
+
+func (m *SnippetModel) OrgTitles(orgID int, offset, limit int) ([]*models.Snippet, error) {
+	if orgID == mockOrgSnippet.OrgID && offset == 0 && limit > 0 {
+		s := mockOrgSnippet
+		return []*models.Snippet{{ID: s.ID, Title: s.Title, Created: s.Created, PublishAt: s.PublishAt, UserID: s.UserID, OrgID: s.OrgID}}, nil
+	}
+	return []*models.Snippet{}, nil
+}
+
+// errMockDatabase is what EachByUser fails with for bob (user 2), so that tests can see
+// what happens when the database goes away.
+var errMockDatabase = errors.New("mocks: database unavailable")
+
+func (m *SnippetModel) EachByUser(userID int, fn func(*models.Snippet) error) error {
+	switch userID {
+	case mockSnippet.UserID:
+		return fn(mockSnippet)
+	case 2:
+		return errMockDatabase
+	}
+	return nil
+}
+
+func (m *SnippetModel) FindDuplicate(userID int, orgID int, content string) (int, error) {
+	for _, s := range []*models.Snippet{mockSnippet, mockOrgSnippet} {
+		if userID == s.UserID && orgID == s.OrgID && content == s.Content {
+			return s.ID, nil
+		}
+	}
+	return 0, models.ErrNoRecord
+}
+
+func (m *SnippetModel) GetByAlias(alias string) (*models.Snippet, error) {
+	switch alias {
+	case "silent-pond":
+		return mockSnippet, nil
+	default:
+		return nil, models.ErrNoRecord
+	}
+}
+
+func (m *SnippetModel) SetTags(id int, tags []string) error {
+	return nil
+}
+
+func (m *SnippetModel) SetAlias(id int, alias string) error {
+	switch alias {
+	case "silent-pond":
+		return models.ErrDuplicateAlias
+	default:
+		return nil
+	}
+}
+
+func (m *SnippetModel) ExpiringSoon(window time.Duration) ([]*models.ExpiryReminder, error) {
+	return []*models.ExpiryReminder{
+		{
+			SnippetID: mockSnippet.ID,
+			Title:     mockSnippet.Title,
+			Expires:   mockSnippet.Expires,
+			Name:      "Alice",
+			Email:     "alice@example.com",
+		},
+	}, nil
+}
+
+func (m *SnippetModel) MarkReminded(id int) error {
+	return nil
+}
+
+func (m *SnippetModel) Extend(id int, days int) error {
+	if id != mockSnippet.ID {
+		return models.ErrNoRecord
+	}
+	return nil
+}
+
+func (m *SnippetModel) RecordView(id int) error {
+	return nil
+}
+
+func (m *SnippetModel) SetStarred(id int, userID int, starred bool) error {
+	return nil
+}
+
+// Stars gives the mock snippet three stars, one of them from user 2.
+func (m *SnippetModel) Stars(id int, userID int) (int, bool, error) {
+	if id != mockSnippet.ID {
+		return 0, false, nil
+	}
+	return 3, userID == 2, nil
+}
+
+func (m *SnippetModel) Trending(days int, limit int) ([]*models.TrendingSnippet, error) {
+	return []*models.TrendingSnippet{
+		{
+			ID:        mockSnippet.ID,
+			Title:     mockSnippet.Title,
+			PublishAt: mockSnippet.PublishAt,
+			Views:     days,
+			Stars:     1,
+			Score:     float64(days + 10),
+		},
+	}, nil
+}
+
+func (m *SnippetModel) SetNoindex(id int, noindex bool) error {
+	return nil
+}
+
+func (m *SnippetModel) SetLanguage(id int, language string) error {
+	return nil
+}
+
+func (m *SnippetModel) Update(id int, title string, content string, language string, confidence float64) error {
+	return nil
+}
+
+// Stats gives user 1 a view every other day, the snippet it created today, and the three
+// stars Stars() says that snippet has.
+func (m *SnippetModel) Stats(userID int, days int) (*models.AccountStats, error) {
+	stats := &models.AccountStats{Top: []*models.TopSnippet{}}
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+
+	for i := 0; i < days; i++ {
+		a := &models.DailyActivity{Day: today.AddDate(0, 0, i-days+1)}
+		if userID == mockSnippet.UserID {
+			a.Views = i % 2
+			stats.Views += a.Views
+		}
+		stats.Daily = append(stats.Daily, a)
+	}
+
+	if userID == mockSnippet.UserID {
+		stats.Snippets = 1
+		stats.Stars = 3
+		stats.Daily[days-1].Created = 1
+		stats.Top = append(stats.Top, &models.TopSnippet{ID: mockSnippet.ID, Title: mockSnippet.Title, Views: stats.Views, Stars: stats.Stars})
+	}
+
+	return stats, nil
+}
+
+func (m *SnippetModel) CountIndexable() (int, error) {
+	return 1, nil
+}
+
+func (m *SnippetModel) Indexable(offset, limit int) ([]*models.SitemapEntry, error) {
+	if offset > 0 {
+		return []*models.SitemapEntry{}, nil
+	}
+	return []*models.SitemapEntry{{ID: mockSnippet.ID, PublishAt: mockSnippet.PublishAt}}, nil
+}
@@ -0,0 +1,71 @@
+package mocks
+
+import (
+	"snippetbox/internal/models"
+	"sync"
+	"time"
+)
+
+// "alice-reset-token" resets alice's password (user 1), and "dave-activation-token"
+// verifies dave's email address (user 3).
+//
+// Unlike the other mocks, TokenModel remembers when it issued tokens, so that tests can
+// check the rate limit on sending them. Tokens can be inserted from a background
+// goroutine, hence the mutex.
+type TokenModel struct {
+	mu     sync.Mutex
+	issued map[issuedKey]time.Time
+}
+
+type issuedKey struct {
+	userID int
+	scope  string
+}
+
+func (m *TokenModel) Insert(email, scope, token string, expires time.Time) error {
+	var userID int
+
+	switch email {
+	case "alice@example.com":
+		userID = 1
+	case "bob@example.com":
+		userID = 2
+	case "dave@example.com":
+		userID = 3
+	default:
+		return models.ErrNoRecord
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.issued == nil {
+		m.issued = make(map[issuedKey]time.Time)
+	}
+	m.issued[issuedKey{userID, scope}] = time.Now()
+
+	return nil
+}
+
+func (m *TokenModel) UserID(token, scope string) (int, error) {
+	if token == "alice-reset-token" && scope == models.ScopePasswordReset {
+		return 1, nil
+	}
+
+	if token == "dave-activation-token" && scope == models.ScopeActivation {
+		return 3, nil
+	}
+
+	return 0, models.ErrNoRecord
+}
+
+func (m *TokenModel) Consume(token, scope string) (int, error) {
+	return m.UserID(token, scope)
+}
+
+func (m *TokenModel) LastIssued(userID int, scope string) (time.Time, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.issued[issuedKey{userID, scope}], nil
+}
@@ -0,0 +1,115 @@
+package mocks
+
+import (
+	"snippetbox/internal/models"
+)
+
+// MockTOTPSecret is erin's (user 4) TOTP secret, so that tests can work out her codes.
+var MockTOTPSecret = []byte("12345678901234567890")
+
+// Erin's recovery codes.
+var mockRecoveryCodes = []string{"abcde-fghij", "klmno-pqrst"}
+
+// Like TokenModel, TwoFactorModel remembers what it's told, so that tests can set up two
+// factor authentication and then log in with it. It starts out with erin's setup. Set
+// NoKeys to behave like a server without encryption keys.
+type TwoFactorModel struct {
+	NoKeys        bool
+	setups        map[int]*mockTwoFactor
+	recoveryCodes map[int][]string
+}
+
+type mockTwoFactor struct {
+	models.TwoFactor
+	lastCounter int64
+}
+
+func (m *TwoFactorModel) init() {
+	if m.setups != nil {
+		return
+	}
+
+	m.setups = map[int]*mockTwoFactor{
+		4: {TwoFactor: models.TwoFactor{UserID: 4, Secret: MockTOTPSecret, Enabled: true}},
+	}
+	m.recoveryCodes = map[int][]string{
+		4: append([]string{}, mockRecoveryCodes...),
+	}
+}
+
+func (m *TwoFactorModel) Get(userID int) (*models.TwoFactor, error) {
+	m.init()
+
+	setup, ok := m.setups[userID]
+	if !ok {
+		return nil, models.ErrNoRecord
+	}
+	if m.NoKeys {
+		return nil, models.ErrNoKeys
+	}
+
+	tf := setup.TwoFactor
+	return &tf, nil
+}
+
+func (m *TwoFactorModel) Begin(userID int, secret []byte) error {
+	m.init()
+
+	if m.NoKeys {
+		return models.ErrNoKeys
+	}
+
+	if setup, ok := m.setups[userID]; ok && setup.Enabled {
+		return nil
+	}
+
+	m.setups[userID] = &mockTwoFactor{TwoFactor: models.TwoFactor{UserID: userID, Secret: secret}}
+	return nil
+}
+
+func (m *TwoFactorModel) Enable(userID int, recoveryCodes []string) error {
+	m.init()
+
+	setup, ok := m.setups[userID]
+	if !ok {
+		return models.ErrNoRecord
+	}
+
+	setup.Enabled = true
+	m.recoveryCodes[userID] = recoveryCodes
+	return nil
+}
+
+func (m *TwoFactorModel) Disable(userID int) error {
+	m.init()
+
+	delete(m.setups, userID)
+	delete(m.recoveryCodes, userID)
+	return nil
+}
+
+func (m *TwoFactorModel) UseCounter(userID int, counter int64) (bool, error) {
+	m.init()
+
+	setup, ok := m.setups[userID]
+	if !ok || counter <= setup.lastCounter {
+		return false, nil
+	}
+
+	setup.lastCounter = counter
+	return true, nil
+}
+
+func (m *TwoFactorModel) UseRecoveryCode(userID int, code string) (int, error) {
+	m.init()
+
+	codes := m.recoveryCodes[userID]
+	for i, c := range codes {
+		if c == code {
+			m.recoveryCodes[userID] = append(codes[:i:i], codes[i+1:]...)
+			return len(codes) - 1, nil
+		}
+	}
+
+	return 0, models.ErrNoRecord
+}
@@ -1,11 +1,21 @@
 package mocks
 
-import "snippetbox/internal/models"
+import (
+	"snippetbox/internal/models"
+	"time"
+)
 
 type UserModelInterface interface {
 	Insert(name, email, password string) error
 	Authenticate(email, password string) (int, error)
 	Exists(id int) (bool, error)
+	IsAdmin(id int) (bool, error)
+	Get(id int) (*models.User, error)
+	PasswordUpdate(id int, currentPassword, newPassword string) error
+	PasswordSet(id int, newPassword string) error
+	Activated(id int) (bool, error)
+	Activate(id int) error
+	PasswordMatches(id int, password string) (bool, error)
 }
 
 type UserModel struct{}
@@ -24,14 +34,71 @@ func (m UserModel) Authenticate(email, password string) (int, error) {
 		return 1, nil
 	}
 
+	if email == "bob@example.com" && password == "pa$$word" {
+		return 2, nil
+	}
+
+	// Dave has signed up but hasn't verified his email address yet.
+	if email == "dave@example.com" && password == "pa$$word" {
+		return 3, nil
+	}
+
+	// Erin has two-factor authentication turned on, see TwoFactorModel.
+	if email == "erin@example.com" && password == "pa$$word" {
+		return 4, nil
+	}
+
 	return 0, models.ErrInvalidCredentials
 }
 
 func (m *UserModel) Exists(id int) (bool, error) {
 	switch id {
-	case 1:
+	case 1, 2, 3, 4:
 		return true, nil
 	default:
 		return false, nil
 	}
 }
+
+func (m *UserModel) IsAdmin(id int) (bool, error) {
+	return id == 1, nil
+}
+
+func (m *UserModel) Get(id int) (*models.User, error) {
+	switch id {
+	case 1:
+		return &models.User{ID: 1, Name: "Alice", Email: "alice@example.com", Created: time.Date(2022, 3, 17, 10, 15, 0, 0, time.UTC), Activated: true}, nil
+	case 2:
+		return &models.User{ID: 2, Name: "Bob", Email: "bob@example.com", Created: time.Date(2023, 1, 5, 9, 0, 0, 0, time.UTC), Activated: true}, nil
+	case 3:
+		return &models.User{ID: 3, Name: "Dave", Email: "dave@example.com", Created: time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)}, nil
+	case 4:
+		return &models.User{ID: 4, Name: "Erin", Email: "erin@example.com", Created: time.Date(2024, 9, 2, 8, 30, 0, 0, time.UTC), Activated: true}, nil
+	default:
+		return nil, models.ErrNoRecord
+	}
+}
+
+func (m *UserModel) PasswordUpdate(id int, currentPassword, newPassword string) error {
+	if id == 1 && currentPassword == "pa$$word" {
+		return nil
+	}
+
+	return models.ErrInvalidCredentials
+}
+
+func (m *UserModel) PasswordSet(id int, newPassword string) error {
+	return nil
+}
+
+func (m *UserModel) Activated(id int) (bool, error) {
+	return id != 3, nil
+}
+
+func (m *UserModel) Activate(id int) error {
+	return nil
+}
+
+func (m *UserModel) PasswordMatches(id int, password string) (bool, error) {
+	return password == "pa$$word", nil
+}
@@ -0,0 +1,394 @@
+package models
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// The roles a member can have in an organization. Owners and admins manage the members
+// (only owners can make or unmake other owners) and can edit any of the organization's
+// snippets; other members can see them all, but only edit their own.
+const (
+	RoleOwner  = "owner"
+	RoleAdmin  = "admin"
+	RoleMember = "member"
+)
+
+// Roles lists the roles in order of seniority.
+var Roles = []string{RoleOwner, RoleAdmin, RoleMember}
+
+// An Org is an organization: a group of users with a shared space for snippets. Slug is
+// the organization's name in URLs, like /org/acme.
+type Org struct {
+	ID      int
+	Name    string
+	Slug    string
+	Created time.Time
+}
+
+// A Membership is one of the organizations a user belongs to, with their role in it.
+type Membership struct {
+	OrgID int
+	Name  string
+	Slug  string
+	Role  string
+}
+
+// A Member is one of the users in an organization.
+type Member struct {
+	UserID int
+	Name   string
+	Email  string
+	Role   string
+	Joined time.Time
+}
+
+// An Invitation asks someone, by email address, to join an organization. We keep a hash of
+// the token that's emailed to them, never the token itself.
+type Invitation struct {
+	ID      int
+	OrgID   int
+	OrgName string
+	OrgSlug string
+	Email   string
+	Role    string
+	Created time.Time
+	Expires time.Time
+}
+
+type OrgModelInterface interface {
+	Insert(name, slug string, ownerID int) (int, error)
+	GetBySlug(slug string) (*Org, error)
+	Role(orgID, userID int) (string, error)
+	ForUser(userID int) ([]*Membership, error)
+	Members(orgID int) ([]*Member, error)
+	SetRole(orgID, userID int, role string) error
+	RemoveMember(orgID, userID int) error
+	Invite(orgID int, email, role, token string, expires time.Time) error
+	Invitations(orgID int) ([]*Invitation, error)
+	GetInvitation(token string) (*Invitation, error)
+	AcceptInvitation(token string, userID int) (*Invitation, error)
+}
+
+// OrgModel wraps the orgs, org_members and org_invitations tables.
+type OrgModel struct {
+	DB *sql.DB
+}
+
+// tokenHash is how invitation tokens are stored. The tokens are long and random, so a
+// plain SHA-256 is enough to make a leaked table useless.
+func tokenHash(token string) []byte {
+	sum := sha256.Sum256([]byte(token))
+	return sum[:]
+}
+
+// Insert creates an organization, with the user creating it as its first owner.
+func (m *OrgModel) Insert(name, slug string, ownerID int) (int, error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("INSERT INTO orgs (name, slug, created) VALUES (?, ?, UTC_TIMESTAMP())", name, slug)
+	if err != nil {
+		var mySQLError *mysql.MySQLError
+		if errors.As(err, &mySQLError) {
+			if mySQLError.Number == 1062 && strings.Contains(mySQLError.Message, "orgs_uc_slug") {
+				return 0, ErrDuplicateSlug
+			}
+		}
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec("INSERT INTO org_members (org_id, user_id, role, joined) VALUES (?, ?, ?, UTC_TIMESTAMP())", id, ownerID, RoleOwner)
+	if err != nil {
+		return 0, err
+	}
+
+	return int(id), tx.Commit()
+}
+
+func (m *OrgModel) GetBySlug(slug string) (*Org, error) {
+	o := &Org{}
+
+	err := m.DB.QueryRow("SELECT id, name, slug, created FROM orgs WHERE slug = ?", slug).Scan(&o.ID, &o.Name, &o.Slug, &o.Created)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
+	}
+
+	return o, nil
+}
+
+// Role returns the user's role in an organization, or "" if they aren't a member.
+func (m *OrgModel) Role(orgID, userID int) (string, error) {
+	var role string
+
+	err := m.DB.QueryRow("SELECT role FROM org_members WHERE org_id = ? AND user_id = ?", orgID, userID).Scan(&role)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", nil
+		}
+		return "", err
+	}
+
+	return role, nil
+}
+
+// ForUser lists the organizations a user belongs to, by name.
+func (m *OrgModel) ForUser(userID int) ([]*Membership, error) {
+	stmt := `SELECT o.id, o.name, o.slug, m.role FROM org_members m INNER JOIN orgs o ON o.id = m.org_id
+    		WHERE m.user_id = ? ORDER BY o.name, o.id`
+
+	rows, err := m.DB.Query(stmt, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	memberships := []*Membership{}
+
+	for rows.Next() {
+		ms := &Membership{}
+		err = rows.Scan(&ms.OrgID, &ms.Name, &ms.Slug, &ms.Role)
+		if err != nil {
+			return nil, err
+		}
+		memberships = append(memberships, ms)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return memberships, nil
+}
+
+// Members lists everyone in an organization, most senior first.
+func (m *OrgModel) Members(orgID int) ([]*Member, error) {
+	stmt := `SELECT u.id, u.name, u.email, m.role, m.joined FROM org_members m INNER JOIN users u ON u.id = m.user_id
+    		WHERE m.org_id = ? ORDER BY FIELD(m.role, 'owner', 'admin', 'member'), u.name, u.id`
+
+	rows, err := m.DB.Query(stmt, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []*Member{}
+
+	for rows.Next() {
+		mb := &Member{}
+		err = rows.Scan(&mb.UserID, &mb.Name, &mb.Email, &mb.Role, &mb.Joined)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, mb)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return members, nil
+}
+
+// SetRole changes a member's role. An organization always keeps at least one owner, so
+// demoting the last one returns ErrLastOwner.
+func (m *OrgModel) SetRole(orgID, userID int, role string) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = m.checkOwners(tx, orgID, userID)
+	if err != nil && !(errors.Is(err, ErrLastOwner) && role == RoleOwner) {
+		return err
+	}
+
+	result, err := tx.Exec("UPDATE org_members SET role = ? WHERE org_id = ? AND user_id = ?", role, orgID, userID)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		// Either they aren't a member, or their role hasn't changed.
+		var exists bool
+		err = tx.QueryRow("SELECT EXISTS(SELECT true FROM org_members WHERE org_id = ? AND user_id = ?)", orgID, userID).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return ErrNoRecord
+		}
+	}
+
+	return tx.Commit()
+}
+
+// RemoveMember takes a user out of an organization. The snippets they posted there stay
+// with the organization. Like SetRole, it won't remove the last owner.
+func (m *OrgModel) RemoveMember(orgID, userID int) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = m.checkOwners(tx, orgID, userID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM org_members WHERE org_id = ? AND user_id = ?", orgID, userID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// checkOwners returns ErrLastOwner if userID is the only owner of the organization. The
+// owners' rows are locked until the transaction ends, so two owners can't demote each
+// other at the same time and leave nobody in charge.
+func (m *OrgModel) checkOwners(tx *sql.Tx, orgID, userID int) error {
+	rows, err := tx.Query("SELECT user_id FROM org_members WHERE org_id = ? AND role = ? FOR UPDATE", orgID, RoleOwner)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	owners := []int{}
+	for rows.Next() {
+		var id int
+		if err = rows.Scan(&id); err != nil {
+			return err
+		}
+		owners = append(owners, id)
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	if len(owners) == 1 && owners[0] == userID {
+		return ErrLastOwner
+	}
+	return nil
+}
+
+// Invite records an invitation to join an organization. Inviting the same address again
+// replaces the earlier invitation, so only the latest email's link works.
+func (m *OrgModel) Invite(orgID int, email, role, token string, expires time.Time) error {
+	stmt := `INSERT INTO org_invitations (org_id, email, role, token_hash, created, expires)
+    		VALUES (?, ?, ?, ?, UTC_TIMESTAMP(), ?)
+    		ON DUPLICATE KEY UPDATE role = VALUES(role), token_hash = VALUES(token_hash), created = VALUES(created), expires = VALUES(expires)`
+
+	_, err := m.DB.Exec(stmt, orgID, email, role, tokenHash(token), expires.UTC())
+	return err
+}
+
+// Invitations lists the invitations to an organization which haven't been accepted yet
+// and haven't expired.
+func (m *OrgModel) Invitations(orgID int) ([]*Invitation, error) {
+	stmt := `SELECT i.id, i.org_id, o.name, o.slug, i.email, i.role, i.created, i.expires
+    		FROM org_invitations i INNER JOIN orgs o ON o.id = i.org_id
+    		WHERE i.org_id = ? AND i.expires > UTC_TIMESTAMP() ORDER BY i.created DESC`
+
+	rows, err := m.DB.Query(stmt, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invitations := []*Invitation{}
+
+	for rows.Next() {
+		i := &Invitation{}
+		err = rows.Scan(&i.ID, &i.OrgID, &i.OrgName, &i.OrgSlug, &i.Email, &i.Role, &i.Created, &i.Expires)
+		if err != nil {
+			return nil, err
+		}
+		invitations = append(invitations, i)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return invitations, nil
+}
+
+// GetInvitation looks up an unexpired invitation by the token from its email.
+func (m *OrgModel) GetInvitation(token string) (*Invitation, error) {
+	stmt := `SELECT i.id, i.org_id, o.name, o.slug, i.email, i.role, i.created, i.expires
+    		FROM org_invitations i INNER JOIN orgs o ON o.id = i.org_id
+    		WHERE i.token_hash = ? AND i.expires > UTC_TIMESTAMP()`
+
+	i := &Invitation{}
+
+	err := m.DB.QueryRow(stmt, tokenHash(token)).Scan(&i.ID, &i.OrgID, &i.OrgName, &i.OrgSlug, &i.Email, &i.Role, &i.Created, &i.Expires)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
+	}
+
+	return i, nil
+}
+
+// AcceptInvitation adds the user to the organization they were invited to, and uses the
+// invitation up. The invitation has to be for the user's own email address: the token
+// alone isn't enough, in case the email was forwarded. It returns ErrNoRecord if there's
+// no such invitation for this user. Someone who is already a member keeps their role.
+func (m *OrgModel) AcceptInvitation(token string, userID int) (*Invitation, error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	stmt := `SELECT i.id, i.org_id, o.name, o.slug, i.email, i.role, i.created, i.expires
+    		FROM org_invitations i INNER JOIN orgs o ON o.id = i.org_id INNER JOIN users u ON u.email = i.email
+    		WHERE i.token_hash = ? AND i.expires > UTC_TIMESTAMP() AND u.id = ? FOR UPDATE`
+
+	i := &Invitation{}
+
+	err = tx.QueryRow(stmt, tokenHash(token), userID).Scan(&i.ID, &i.OrgID, &i.OrgName, &i.OrgSlug, &i.Email, &i.Role, &i.Created, &i.Expires)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
+	}
+
+	_, err = tx.Exec("INSERT IGNORE INTO org_members (org_id, user_id, role, joined) VALUES (?, ?, ?, UTC_TIMESTAMP())", i.OrgID, userID, i.Role)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec("DELETE FROM org_invitations WHERE id = ?", i.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return i, tx.Commit()
+}
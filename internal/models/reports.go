@@ -0,0 +1,169 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// The actions a moderator can take when resolving a report.
+const (
+	ModerationDismiss = "dismiss"
+	ModerationHide    = "hide"
+	ModerationSuspend = "suspend"
+)
+
+// Define a Report type to hold a user's complaint about a snippet. SnippetTitle and
+// AuthorID are copied from the reported snippet so the moderation queue can show them
+// without a second query.
+type Report struct {
+	ID           int
+	SnippetID    int
+	SnippetTitle string
+	AuthorID     int
+	ReporterID   int
+	Reason       string
+	Created      time.Time
+	Resolved     bool
+}
+
+// A ModerationAction records which moderator did what about which report.
+type ModerationAction struct {
+	ID          int
+	ReportID    int
+	SnippetID   int
+	ModeratorID int
+	Action      string
+	Created     time.Time
+}
+
+type ReportModelInterface interface {
+	Insert(snippetID, reporterID int, reason string) error
+	Open() ([]*Report, error)
+	Resolve(id, moderatorID int, action string) error
+	RecentActions() ([]*ModerationAction, error)
+}
+
+// Define a ReportModel type which wraps a database connection pool.
+type ReportModel struct {
+	DB *sql.DB
+}
+
+// Insert files a new report against a snippet.
+func (m *ReportModel) Insert(snippetID, reporterID int, reason string) error {
+	stmt := `INSERT INTO reports (snippet_id, reporter_id, reason, created)
+			VALUES(?, ?, ?, UTC_TIMESTAMP())`
+
+	_, err := m.DB.Exec(stmt, snippetID, reporterID, reason)
+	return err
+}
+
+// Open returns all unresolved reports, oldest first, which is the order moderators
+// should work through them in.
+func (m *ReportModel) Open() ([]*Report, error) {
+	stmt := `SELECT r.id, r.snippet_id, s.title, IFNULL(s.user_id, 0), r.reporter_id, r.reason, r.created, r.resolved
+			FROM reports r INNER JOIN snippets s ON s.id = r.snippet_id
+			WHERE r.resolved = FALSE ORDER BY r.id ASC`
+
+	rows, err := m.DB.Query(stmt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reports := []*Report{}
+
+	for rows.Next() {
+		r := &Report{}
+		err = rows.Scan(&r.ID, &r.SnippetID, &r.SnippetTitle, &r.AuthorID, &r.ReporterID, &r.Reason, &r.Created, &r.Resolved)
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, r)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return reports, nil
+}
+
+// Resolve closes a report and carries out the moderator's decision. Hiding a snippet
+// takes it out of Get() and Latest(); suspending the author stops them logging in and
+// ends their existing sessions (see UserModel.Exists). The report, the decision and the
+// log entry in moderation_actions are all written in one transaction, so an action is
+// never applied without being recorded.
+func (m *ReportModel) Resolve(id, moderatorID int, action string) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var snippetID int
+	err = tx.QueryRow("SELECT snippet_id FROM reports WHERE id = ? AND resolved = FALSE FOR UPDATE", id).Scan(&snippetID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNoRecord
+		}
+		return err
+	}
+
+	switch action {
+	case ModerationDismiss:
+	case ModerationHide:
+		_, err = tx.Exec("UPDATE snippets SET hidden = TRUE WHERE id = ?", snippetID)
+	case ModerationSuspend:
+		_, err = tx.Exec(`UPDATE users SET suspended = TRUE
+				WHERE id = (SELECT user_id FROM snippets WHERE id = ?)`, snippetID)
+	default:
+		return ErrInvalidAction
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE reports SET resolved = TRUE WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	stmt := `INSERT INTO moderation_actions (report_id, snippet_id, moderator_id, action, created)
+			VALUES(?, ?, ?, ?, UTC_TIMESTAMP())`
+	_, err = tx.Exec(stmt, id, snippetID, moderatorID, action)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// RecentActions returns the 20 most recent moderation decisions.
+func (m *ReportModel) RecentActions() ([]*ModerationAction, error) {
+	stmt := `SELECT id, report_id, snippet_id, moderator_id, action, created FROM moderation_actions
+			ORDER BY id DESC LIMIT 20`
+
+	rows, err := m.DB.Query(stmt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	actions := []*ModerationAction{}
+
+	for rows.Next() {
+		a := &ModerationAction{}
+		err = rows.Scan(&a.ID, &a.ReportID, &a.SnippetID, &a.ModeratorID, &a.Action, &a.Created)
+		if err != nil {
+			return nil, err
+		}
+		actions = append(actions, a)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return actions, nil
+}
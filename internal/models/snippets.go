@@ -1,40 +1,179 @@
 package models
 
 import (
+	"crypto/sha256"
 	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
+	"fmt"
+	"strings"
 	"time"
+
+	"snippetbox/internal/envelope"
+
+	"github.com/go-sql-driver/mysql"
 )
 
 // Define a snippet type to hold the data for an individual snippet.
 // Notice the fields of the struct correspond to the fields in our MySQL snippets table?
 
 type Snippet struct {
-	ID      int
-	Title   string
-	Content string
-	Created time.Time
-	Expires time.Time
+	ID        int
+	Title     string
+	Content   string
+	Created   time.Time
+	Expires   time.Time
+	UserID    int
+	Hash      string
+	Alias     string
+	PublishAt time.Time
+	Noindex   bool
+	Author    string // the owner's name, only filled in by Get() and GetByAlias()
+
+	// Updated is when the content last changed: when it was last edited, or Created if it
+	// never has been. Only Get() and GetByAlias() fill it in.
+	Updated time.Time
+
+	// Language is the language the snippet is written in, or "" if it isn't known. It is
+	// either picked by the owner, with a LanguageConfidence of 1, or guessed for them.
+	Language           string
+	LanguageConfidence float64
+
+	// ClientEncrypted snippets were encrypted in the browser before they were sent to us,
+	// and Content holds only the ciphertext. The key never reaches the server, so treat the
+	// content as opaque: don't scan it, number its lines or quote it anywhere.
+	ClientEncrypted bool
+
+	// OrgID is the organization the snippet was posted to, or 0 for a personal snippet.
+	// Only the organization's members can see it.
+	OrgID int
+
+	// Tags are the short labels the owner has filed the snippet under, in alphabetical
+	// order. Only Get(), GetByAlias() and EachByUser() fill them in.
+	Tags []string
+
+	// If the content is stored encrypted, keyID and dataKey are what's needed to decrypt
+	// it. See SnippetModel.open().
+	keyID   string
+	dataKey []byte
+}
+
+// Published reports whether the snippet's publication time has arrived. Until then only
+// its owner should be shown it.
+func (s *Snippet) Published() bool {
+	return !s.PublishAt.After(time.Now())
+}
+
+// Public reports whether anyone at all can see the snippet: it has been published, and it
+// isn't kept within an organization.
+func (s *Snippet) Public() bool {
+	return s.Published() && s.OrgID == 0
 }
 
 type SnippetModelInterface interface {
-	Insert(title string, content string, expires int) (int, error)
+	Insert(title string, content string, expires int, userID int, publishAt time.Time, noindex bool, language string, confidence float64, clientEncrypted bool, orgID int) (int, error)
 	Get(id int) (*Snippet, error)
 	Latest() ([]*Snippet, error)
+	LatestByUser(userID int) ([]*Snippet, error)
+	LatestByTag(tag string) ([]*Snippet, error)
+	ByOrg(orgID int, offset, limit int) ([]*Snippet, error)
+	OrgTitles(orgID int, offset, limit int) ([]*Snippet, error)
+	EachByUser(userID int, fn func(*Snippet) error) error
+	FindDuplicate(userID int, orgID int, content string) (int, error)
+	GetByAlias(alias string) (*Snippet, error)
+	SetTags(id int, tags []string) error
+	SetAlias(id int, alias string) error
+	ExpiringSoon(window time.Duration) ([]*ExpiryReminder, error)
+	MarkReminded(id int) error
+	Extend(id int, days int) error
+	RecordView(id int) error
+	SetStarred(id int, userID int, starred bool) error
+	Stars(id int, userID int) (int, bool, error)
+	Trending(days int, limit int) ([]*TrendingSnippet, error)
+	SetNoindex(id int, noindex bool) error
+	SetLanguage(id int, language string) error
+	Update(id int, title string, content string, language string, confidence float64) error
+	Stats(userID int, days int) (*AccountStats, error)
+	CountIndexable() (int, error)
+	Indexable(offset, limit int) ([]*SitemapEntry, error)
+}
+
+// A SitemapEntry is one URL in the sitemap.
+type SitemapEntry struct {
+	ID        int
+	PublishAt time.Time
+}
+
+// A TrendingSnippet is a snippet's entry on the trending page. Score is its time-decayed
+// count of views and stars over the chosen window, and Views and Stars the raw counts over
+// the same window.
+type TrendingSnippet struct {
+	ID        int
+	Title     string
+	PublishAt time.Time
+	Views     int
+	Stars     int
+	Score     float64
+}
+
+// starWeight is how many views a star counts as in the trending score. Anyone passing can
+// view a snippet, but starring one takes an account and a decision to.
+const starWeight = 10
+
+// An ExpiryReminder has what we need to email a snippet's owner before it expires.
+type ExpiryReminder struct {
+	SnippetID int
+	Title     string
+	Expires   time.Time
+	Name      string
+	Email     string
+}
+
+// ContentHash returns the hex encoded SHA-256 of a snippet's content. It's what goes in the
+// content_hash column when no keys are loaded: see SnippetModel.contentHash().
+func ContentHash(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
 }
 
 // Define a SnippetModel type which wraps a sql.DB connection pool.
 type SnippetModel struct {
 	DB *sql.DB
+
+	// Keys encrypts snippet content before it's written to the database. If it's nil,
+	// content is stored as plain text (and encrypted content can't be read).
+	Keys *envelope.Keyring
 }
 
-// This will insert a new snippet into the database
-func (m *SnippetModel) Insert(title string, content string, expires int) (int, error) {
+// This will insert a new snippet into the database. A zero publishAt means publish straight
+// away. Either way the snippet expires the given number of days after it is published.
+// confidence says how sure we are of the language: 1 if the user chose it.
+func (m *SnippetModel) Insert(title string, content string, expires int, userID int, publishAt time.Time, noindex bool, language string, confidence float64, clientEncrypted bool, orgID int) (int, error) {
+	// A NULL publish time is replaced with UTC_TIMESTAMP() by the database, so that created
+	// and publish_at come from the same clock for snippets which aren't scheduled.
+	var publish any
+	if !publishAt.IsZero() {
+		publish = publishAt.UTC()
+	}
+
+	// Personal snippets have a NULL org_id.
+	var org any
+	if orgID != 0 {
+		org = orgID
+	}
+
+	stored, keyID, dataKey, err := m.seal(content)
+	if err != nil {
+		return 0, err
+	}
+	hash, hashKeyID := m.contentHash(content)
+
 	// Write the SQL statement we want to execute. I've split it over two lines for readability
 	// (which is why it's surrounded with backquotes instead of normal doubel quotes)
-	stmt := `INSERT INTO snippets (title, content, created, expires)
-			VALUES(?, ?, UTC_TIMESTAMP(), DATE_ADD(UTC_TIMESTAMP(), INTERVAL ? DAY))`
-	result, err := m.DB.Exec(stmt, title, content, expires)
+	stmt := `INSERT INTO snippets (title, content, created, publish_at, expires, user_id, content_hash, hash_key_id, noindex, language, language_confidence, key_id, data_key, client_encrypted, org_id)
+			VALUES(?, ?, UTC_TIMESTAMP(), IFNULL(?, UTC_TIMESTAMP()), DATE_ADD(IFNULL(?, UTC_TIMESTAMP()), INTERVAL ? DAY), ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	result, err := m.DB.Exec(stmt, title, stored, publish, publish, expires, userID, hash, hashKeyID, noindex, language, confidence, keyID, dataKey, clientEncrypted, org)
 	if err != nil {
 		return 0, err
 	}
@@ -51,11 +190,155 @@ func (m *SnippetModel) Insert(title string, content string, expires int) (int, e
 
 }
 
-// This will return a specific snippet based on its id.
+// seal encrypts content for storage, if we have keys to do it with. It returns what to
+// store in the content, key_id and data_key columns. The ciphertext is base64 encoded so
+// that the content column can stay a text column.
+func (m *SnippetModel) seal(content string) (string, string, []byte, error) {
+	if m.Keys == nil {
+		return content, "", nil, nil
+	}
+
+	sealed, err := m.Keys.Seal([]byte(content))
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	return base64.StdEncoding.EncodeToString(sealed.Ciphertext), sealed.KeyID, sealed.DataKey, nil
+}
+
+// contentHash returns what to store in the content_hash and hash_key_id columns for some
+// content. An unkeyed hash would let anyone with a copy of the database confirm a guess at
+// what a snippet says, encrypted or not, so when we have keys it's an HMAC under the current
+// one instead, and hash_key_id records which. Without keys, the content is in the database
+// as plain text anyway, and ContentHash() is used with an empty hash_key_id.
+func (m *SnippetModel) contentHash(content string) (string, string) {
+	if m.Keys == nil {
+		return ContentHash(content), ""
+	}
+	return hex.EncodeToString(m.Keys.MAC([]byte(content))), m.Keys.CurrentID()
+}
+
+// open decrypts a snippet's content in place after it has been read from the database.
+// Rows written before encryption was turned on have no key ID and are left alone.
+func (m *SnippetModel) open(s *Snippet) error {
+	if s.keyID == "" {
+		return nil
+	}
+	if m.Keys == nil {
+		return fmt.Errorf("models: snippet %d is encrypted but no keys are loaded", s.ID)
+	}
+
+	ciphertext, err := base64.StdEncoding.DecodeString(s.Content)
+	if err != nil {
+		return fmt.Errorf("models: snippet %d: %w", s.ID, err)
+	}
+
+	plaintext, err := m.Keys.Open(&envelope.Sealed{KeyID: s.keyID, DataKey: s.dataKey, Ciphertext: ciphertext})
+	if err != nil {
+		return fmt.Errorf("models: snippet %d: %w", s.ID, err)
+	}
+
+	s.Content = string(plaintext)
+	return nil
+}
+
+// Reencrypt moves up to limit snippets onto the current key, and returns how many it
+// moved. Snippets already encrypted under an older key just have their data key re-wrapped;
+// plain text ones are encrypted for the first time. Either way the content hash is redone
+// under the current key, which means decrypting the content to get at it. Call it until
+// it returns 0.
+func (m *SnippetModel) Reencrypt(limit int) (int, error) {
+	if m.Keys == nil {
+		return 0, errors.New("models: no keys loaded")
+	}
+
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// Lock the batch, so that nothing else changes these rows between reading and
+	// rewriting them. A row can be on the current key but still have its hash made under
+	// an old one (or no key at all), if it was written before hashes were keyed.
+	stmt := `SELECT id, content, key_id, data_key FROM snippets WHERE key_id <> ? OR hash_key_id <> ? LIMIT ? FOR UPDATE`
+
+	rows, err := tx.Query(stmt, m.Keys.CurrentID(), m.Keys.CurrentID(), limit)
+	if err != nil {
+		return 0, err
+	}
+
+	batch := []*Snippet{}
+	for rows.Next() {
+		s := &Snippet{}
+		err = rows.Scan(&s.ID, &s.Content, &s.keyID, &s.dataKey)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		batch = append(batch, s)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, s := range batch {
+		var content, keyID, plaintext string
+		var dataKey []byte
+
+		if s.keyID == "" {
+			plaintext = s.Content
+			content, keyID, dataKey, err = m.seal(s.Content)
+			if err != nil {
+				return 0, err
+			}
+		} else {
+			ciphertext, err := base64.StdEncoding.DecodeString(s.Content)
+			if err != nil {
+				return 0, fmt.Errorf("models: snippet %d: %w", s.ID, err)
+			}
+			sealed := &envelope.Sealed{KeyID: s.keyID, DataKey: s.dataKey, Ciphertext: ciphertext}
+
+			opened, err := m.Keys.Open(sealed)
+			if err != nil {
+				return 0, fmt.Errorf("models: snippet %d: %w", s.ID, err)
+			}
+			plaintext = string(opened)
+
+			sealed, err = m.Keys.Rewrap(sealed)
+			if err != nil {
+				return 0, fmt.Errorf("models: snippet %d: %w", s.ID, err)
+			}
+			content, keyID, dataKey = s.Content, sealed.KeyID, sealed.DataKey
+		}
+
+		hash, hashKeyID := m.contentHash(plaintext)
+
+		_, err = tx.Exec("UPDATE snippets SET content = ?, key_id = ?, data_key = ?, content_hash = ?, hash_key_id = ? WHERE id = ?", content, keyID, dataKey, hash, hashKeyID, s.ID)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+
+	return len(batch), nil
+}
+
+// This will return a specific snippet based on its id. Scheduled snippets are returned
+// too, so check Published() before showing one to anybody but its owner.
 func (m *SnippetModel) Get(id int) (*Snippet, error) {
 	// Write the SQL statement we want to execute.
-	stmt := `SELECT id, title, content, created, expires FROM snippets
-    		WHERE expires > UTC_TIMESTAMP() AND id = ?`
+	stmt := `SELECT s.id, s.title, s.content, s.created, s.expires, IFNULL(s.user_id, 0), s.content_hash, IFNULL(s.alias, ''),
+    		s.publish_at, s.noindex, s.language, s.language_confidence, s.key_id, s.data_key, s.client_encrypted, IFNULL(s.org_id, 0), IFNULL(u.name, ''),
+    		IFNULL(s.updated, s.created),
+    		IFNULL((SELECT GROUP_CONCAT(t.tag ORDER BY t.tag SEPARATOR ' ') FROM snippet_tags t WHERE t.snippet_id = s.id), '')
+    		FROM snippets s LEFT JOIN users u ON u.id = s.user_id
+    		WHERE s.expires > UTC_TIMESTAMP() AND s.hidden = FALSE AND s.id = ?`
 
 	// Use the QeuryRow() method on the connection pool to execute our SQL statement
 	// passing in the untrusted id variable as the value for the placeholder parameter
@@ -64,12 +347,13 @@ func (m *SnippetModel) Get(id int) (*Snippet, error) {
 
 	// Initialize a pointer to a new zeroed Snippet struct
 	s := &Snippet{}
+	var tags string
 
 	// Use row.Scan to copy the values from each field in sql.Row to the corresponding field
 	// in the Snippet struct. Notice that the arguments to row.Scan are *pointers* to the place
 	// you want to copy the data into, and the number of arguments must be exactly the same as the
 	// number of columns returned by your statement.
-	err := row.Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Expires)
+	err := row.Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Expires, &s.UserID, &s.Hash, &s.Alias, &s.PublishAt, &s.Noindex, &s.Language, &s.LanguageConfidence, &s.keyID, &s.dataKey, &s.ClientEncrypted, &s.OrgID, &s.Author, &s.Updated, &tags)
 	if err != nil {
 		// If the query returns no rows, then row.Scan() will return a sql.ErrNoRows error.
 		// We use the errors.Is() function check for the erro specifically, and return our own
@@ -81,16 +365,25 @@ func (m *SnippetModel) Get(id int) (*Snippet, error) {
 		}
 
 	}
+
+	s.Tags = strings.Fields(tags)
+
+	err = m.open(s)
+	if err != nil {
+		return nil, err
+	}
+
 	// If everything went OK then return the Snippet object
 	return s, nil
 
 }
 
-// This will return the 10 most recently created snippets.
+// This will return the 10 most recently published snippets.
 func (m *SnippetModel) Latest() ([]*Snippet, error) {
 	// Write the SQL statement
-	stmt := `SELECT id, title, content, created, expires FROM snippets
-    		WHERE expires > UTC_TIMESTAMP() ORDER BY id DESC LIMIT 10`
+	stmt := `SELECT id, title, content, created, expires, IFNULL(user_id, 0), content_hash, IFNULL(alias, ''), publish_at, noindex, language, language_confidence, key_id, data_key, client_encrypted, IFNULL(org_id, 0) FROM snippets
+    		WHERE expires > UTC_TIMESTAMP() AND hidden = FALSE AND publish_at <= UTC_TIMESTAMP() AND org_id IS NULL
+    		ORDER BY publish_at DESC, id DESC LIMIT 10`
 
 	// Use the Query() method on the connection pool to execute our SQL statement
 	// This returns a sql.Rows resultset containing the result of our query.
@@ -117,7 +410,11 @@ func (m *SnippetModel) Latest() ([]*Snippet, error) {
 		// use rows.Scan() to copy the values from each field in the row to the new Snippet object that we created/
 		// Again, the arguments to row.Scan() must be pointers to the place you want to copy the data into,
 		// and the number of arguments must be exactly the same as the numer of columns returned by your statement
-		err = rows.Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Expires)
+		err = rows.Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Expires, &s.UserID, &s.Hash, &s.Alias, &s.PublishAt, &s.Noindex, &s.Language, &s.LanguageConfidence, &s.keyID, &s.dataKey, &s.ClientEncrypted, &s.OrgID)
+		if err != nil {
+			return nil, err
+		}
+		err = m.open(s)
 		if err != nil {
 			return nil, err
 		}
@@ -137,6 +434,507 @@ func (m *SnippetModel) Latest() ([]*Snippet, error) {
 
 } // end of func Latest
 
+// LatestByUser returns the 10 most recently published snippets created by a user.
+func (m *SnippetModel) LatestByUser(userID int) ([]*Snippet, error) {
+	stmt := `SELECT id, title, content, created, expires, IFNULL(user_id, 0), content_hash, IFNULL(alias, ''), publish_at, noindex, language, language_confidence, key_id, data_key, client_encrypted, IFNULL(org_id, 0) FROM snippets
+    		WHERE expires > UTC_TIMESTAMP() AND hidden = FALSE AND publish_at <= UTC_TIMESTAMP() AND org_id IS NULL AND user_id = ?
+    		ORDER BY publish_at DESC, id DESC LIMIT 10`
+
+	rows, err := m.DB.Query(stmt, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	snippets := []*Snippet{}
+
+	for rows.Next() {
+		s := &Snippet{}
+		err = rows.Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Expires, &s.UserID, &s.Hash, &s.Alias, &s.PublishAt, &s.Noindex, &s.Language, &s.LanguageConfidence, &s.keyID, &s.dataKey, &s.ClientEncrypted, &s.OrgID)
+		if err != nil {
+			return nil, err
+		}
+		err = m.open(s)
+		if err != nil {
+			return nil, err
+		}
+		snippets = append(snippets, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return snippets, nil
+}
+
+// LatestByTag returns the 10 most recently published public snippets filed under a tag.
+func (m *SnippetModel) LatestByTag(tag string) ([]*Snippet, error) {
+	stmt := `SELECT s.id, s.title, s.content, s.created, s.expires, IFNULL(s.user_id, 0), s.content_hash, IFNULL(s.alias, ''), s.publish_at, s.noindex, s.language, s.language_confidence, s.key_id, s.data_key, s.client_encrypted, IFNULL(s.org_id, 0)
+    		FROM snippets s INNER JOIN snippet_tags t ON t.snippet_id = s.id
+    		WHERE s.expires > UTC_TIMESTAMP() AND s.hidden = FALSE AND s.publish_at <= UTC_TIMESTAMP() AND s.org_id IS NULL AND t.tag = ?
+    		ORDER BY s.publish_at DESC, s.id DESC LIMIT 10`
+
+	rows, err := m.DB.Query(stmt, tag)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	snippets := []*Snippet{}
+
+	for rows.Next() {
+		s := &Snippet{}
+		err = rows.Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Expires, &s.UserID, &s.Hash, &s.Alias, &s.PublishAt, &s.Noindex, &s.Language, &s.LanguageConfidence, &s.keyID, &s.dataKey, &s.ClientEncrypted, &s.OrgID)
+		if err != nil {
+			return nil, err
+		}
+		err = m.open(s)
+		if err != nil {
+			return nil, err
+		}
+		snippets = append(snippets, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return snippets, nil
+}
+
+// ByOrg returns one page of the published snippets in an organization, newest first, with
+// their content. The organization's search looks through these a page at a time, because
+// the content may be encrypted in the database. To list them, use OrgTitles() instead.
+func (m *SnippetModel) ByOrg(orgID int, offset, limit int) ([]*Snippet, error) {
+	stmt := `SELECT id, title, content, created, expires, IFNULL(user_id, 0), content_hash, IFNULL(alias, ''), publish_at, noindex, language, language_confidence, key_id, data_key, client_encrypted, IFNULL(org_id, 0) FROM snippets
+    		WHERE expires > UTC_TIMESTAMP() AND hidden = FALSE AND publish_at <= UTC_TIMESTAMP() AND org_id = ?
+    		ORDER BY publish_at DESC, id DESC LIMIT ? OFFSET ?`
+
+	rows, err := m.DB.Query(stmt, orgID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	snippets := []*Snippet{}
+
+	for rows.Next() {
+		s := &Snippet{}
+		err = rows.Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Expires, &s.UserID, &s.Hash, &s.Alias, &s.PublishAt, &s.Noindex, &s.Language, &s.LanguageConfidence, &s.keyID, &s.dataKey, &s.ClientEncrypted, &s.OrgID)
+		if err != nil {
+			return nil, err
+		}
+
+		err = m.open(s)
+		if err != nil {
+			return nil, err
+		}
+
+		snippets = append(snippets, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return snippets, nil
+}
+
+// OrgTitles returns the same page of an organization's snippets as ByOrg(), but only
+// fills in their ID, title, creation and publication times and owner. There's no content
+// to read or decrypt, so it's cheap enough to list the organization's snippets with.
+func (m *SnippetModel) OrgTitles(orgID int, offset, limit int) ([]*Snippet, error) {
+	stmt := `SELECT id, title, created, publish_at, IFNULL(user_id, 0), IFNULL(org_id, 0) FROM snippets
+    		WHERE expires > UTC_TIMESTAMP() AND hidden = FALSE AND publish_at <= UTC_TIMESTAMP() AND org_id = ?
+    		ORDER BY publish_at DESC, id DESC LIMIT ? OFFSET ?`
+
+	rows, err := m.DB.Query(stmt, orgID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	snippets := []*Snippet{}
+
+	for rows.Next() {
+		s := &Snippet{}
+		err = rows.Scan(&s.ID, &s.Title, &s.Created, &s.PublishAt, &s.UserID, &s.OrgID)
+		if err != nil {
+			return nil, err
+		}
+		snippets = append(snippets, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return snippets, nil
+}
+
+// EachByUser calls fn for every unexpired snippet owned by the given user, oldest first.
+// Rows are handed to fn one at a time as they are read from the resultset, so callers
+// can stream a user's snippets somewhere without holding all of them in memory.
+// If fn returns an error the iteration stops and that error is returned.
+func (m *SnippetModel) EachByUser(userID int, fn func(*Snippet) error) error {
+	stmt := `SELECT id, title, content, created, expires, IFNULL(user_id, 0), content_hash, IFNULL(alias, ''), publish_at, noindex, language, language_confidence, key_id, data_key, client_encrypted, IFNULL(org_id, 0),
+    		IFNULL((SELECT GROUP_CONCAT(t.tag ORDER BY t.tag SEPARATOR ' ') FROM snippet_tags t WHERE t.snippet_id = snippets.id), '')
+    		FROM snippets WHERE expires > UTC_TIMESTAMP() AND user_id = ? ORDER BY id ASC`
+
+	rows, err := m.DB.Query(stmt, userID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		s := &Snippet{}
+		var tags string
+		err = rows.Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Expires, &s.UserID, &s.Hash, &s.Alias, &s.PublishAt, &s.Noindex, &s.Language, &s.LanguageConfidence, &s.keyID, &s.dataKey, &s.ClientEncrypted, &s.OrgID, &tags)
+		if err != nil {
+			return err
+		}
+		s.Tags = strings.Fields(tags)
+		err = m.open(s)
+		if err != nil {
+			return err
+		}
+
+		err = fn(s)
+		if err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+} // end of func EachByUser
+
+// FindDuplicate returns the ID of an unexpired snippet owned by the user with the same
+// content, in the same place (the organization, or 0 for their personal snippets), or
+// ErrNoRecord if they don't have one. A copy posted somewhere else doesn't count: the
+// people it was posted for may not be able to see it. Snippets whose hashes were made
+// under an older key won't be found until cmd/reencrypt has redone them.
+func (m *SnippetModel) FindDuplicate(userID int, orgID int, content string) (int, error) {
+	// <=> is MySQL's NULL-safe equals, so that a NULL org matches personal snippets.
+	stmt := `SELECT id FROM snippets
+    		WHERE expires > UTC_TIMESTAMP() AND hidden = FALSE AND user_id = ? AND org_id <=> ? AND content_hash = ?
+    		ORDER BY id DESC LIMIT 1`
+
+	var org any
+	if orgID != 0 {
+		org = orgID
+	}
+
+	hash, _ := m.contentHash(content)
+
+	var id int
+	err := m.DB.QueryRow(stmt, userID, org, hash).Scan(&id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrNoRecord
+		}
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// GetByAlias returns the snippet which has claimed the given alias.
+func (m *SnippetModel) GetByAlias(alias string) (*Snippet, error) {
+	stmt := `SELECT s.id, s.title, s.content, s.created, s.expires, IFNULL(s.user_id, 0), s.content_hash, IFNULL(s.alias, ''),
+    		s.publish_at, s.noindex, s.language, s.language_confidence, s.key_id, s.data_key, s.client_encrypted, IFNULL(s.org_id, 0), IFNULL(u.name, ''),
+    		IFNULL(s.updated, s.created),
+    		IFNULL((SELECT GROUP_CONCAT(t.tag ORDER BY t.tag SEPARATOR ' ') FROM snippet_tags t WHERE t.snippet_id = s.id), '')
+    		FROM snippets s LEFT JOIN users u ON u.id = s.user_id
+    		WHERE s.expires > UTC_TIMESTAMP() AND s.hidden = FALSE AND s.alias = ?`
+
+	s := &Snippet{}
+	var tags string
+	err := m.DB.QueryRow(stmt, alias).Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Expires, &s.UserID, &s.Hash, &s.Alias, &s.PublishAt, &s.Noindex, &s.Language, &s.LanguageConfidence, &s.keyID, &s.dataKey, &s.ClientEncrypted, &s.OrgID, &s.Author, &s.Updated, &tags)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
+	}
+	s.Tags = strings.Fields(tags)
+
+	err = m.open(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// SetTags replaces a snippet's tags with the given ones, which should already have been
+// checked against validator.TagRX.
+func (m *SnippetModel) SetTags(id int, tags []string) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("DELETE FROM snippet_tags WHERE snippet_id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	for _, tag := range tags {
+		_, err = tx.Exec("INSERT INTO snippet_tags (snippet_id, tag) VALUES(?, ?)", id, tag)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// SetAlias gives a snippet a new alias, replacing any it had before. An empty alias
+// removes it. Uniqueness is left to the snippets_uc_alias index, in the same way as
+// UserModel.Insert() relies on users_uc_email.
+func (m *SnippetModel) SetAlias(id int, alias string) error {
+	var value any
+	if alias != "" {
+		value = alias
+	}
+
+	_, err := m.DB.Exec("UPDATE snippets SET alias = ? WHERE id = ?", value, id)
+	if err != nil {
+		var mySQLError *mysql.MySQLError
+		if errors.As(err, &mySQLError) {
+			if mySQLError.Number == 1062 && strings.Contains(mySQLError.Message, "snippets_uc_alias") {
+				return ErrDuplicateAlias
+			}
+		}
+		return err
+	}
+	return nil
+}
+
+// ExpiringSoon returns the owned snippets which will expire within the window and whose
+// owners haven't been reminded about them yet.
+func (m *SnippetModel) ExpiringSoon(window time.Duration) ([]*ExpiryReminder, error) {
+	stmt := `SELECT s.id, s.title, s.expires, u.name, u.email
+    		FROM snippets s INNER JOIN users u ON u.id = s.user_id
+    		WHERE s.expires > UTC_TIMESTAMP() AND s.expires <= DATE_ADD(UTC_TIMESTAMP(), INTERVAL ? SECOND)
+    		AND s.hidden = FALSE AND s.reminder_sent = FALSE
+    		ORDER BY s.expires ASC`
+
+	rows, err := m.DB.Query(stmt, int(window.Seconds()))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reminders := []*ExpiryReminder{}
+
+	for rows.Next() {
+		e := &ExpiryReminder{}
+		err = rows.Scan(&e.SnippetID, &e.Title, &e.Expires, &e.Name, &e.Email)
+		if err != nil {
+			return nil, err
+		}
+		reminders = append(reminders, e)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return reminders, nil
+}
+
+// MarkReminded records that the owner has been emailed about the snippet's expiry.
+func (m *SnippetModel) MarkReminded(id int) error {
+	_, err := m.DB.Exec("UPDATE snippets SET reminder_sent = TRUE WHERE id = ?", id)
+	return err
+}
+
+// Extend pushes a snippet's expiry date out to the given number of days from now, and
+// re-arms the reminder for the new date. A snippet which hasn't been published yet gets
+// the days from its publication time instead, the same as Insert() gives it.
+func (m *SnippetModel) Extend(id int, days int) error {
+	stmt := `UPDATE snippets SET expires = DATE_ADD(GREATEST(UTC_TIMESTAMP(), publish_at), INTERVAL ? DAY), reminder_sent = FALSE
+    		WHERE id = ? AND expires > UTC_TIMESTAMP()`
+
+	result, err := m.DB.Exec(stmt, days, id)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+// RecordView counts one view of a snippet against today's date.
+func (m *SnippetModel) RecordView(id int) error {
+	stmt := `INSERT INTO snippet_views (snippet_id, day, views) VALUES(?, UTC_DATE(), 1)
+    		ON DUPLICATE KEY UPDATE views = views + 1`
+
+	_, err := m.DB.Exec(stmt, id)
+	return err
+}
+
+// SetStarred stars a snippet for a user, or takes their star away. Each user can star a
+// snippet once, so starring it again changes nothing.
+func (m *SnippetModel) SetStarred(id int, userID int, starred bool) error {
+	if !starred {
+		_, err := m.DB.Exec("DELETE FROM snippet_stars WHERE snippet_id = ? AND user_id = ?", id, userID)
+		return err
+	}
+
+	stmt := `INSERT IGNORE INTO snippet_stars (snippet_id, user_id, created) VALUES(?, ?, UTC_TIMESTAMP())`
+
+	_, err := m.DB.Exec(stmt, id, userID)
+	return err
+}
+
+// Stars returns how many stars a snippet has, and whether the given user is one of the
+// people who starred it. A userID of 0 (nobody logged in) has never starred anything.
+func (m *SnippetModel) Stars(id int, userID int) (int, bool, error) {
+	stmt := `SELECT COUNT(*), IFNULL(MAX(user_id = ?), FALSE) FROM snippet_stars WHERE snippet_id = ?`
+
+	var count int
+	var starred bool
+	err := m.DB.QueryRow(stmt, userID, id).Scan(&count, &starred)
+	return count, starred, err
+}
+
+// Trending ranks the visible snippets by their views and stars over the last days days,
+// with each star worth starWeight views. Each day's views and stars are worth half as much
+// for every half-life that has passed since, where the half-life is a third of the window,
+// so a burst of interest today beats a steady trickle earlier in the window. The ranking is
+// done entirely in MySQL, using the daily buckets in snippet_views and the star times in
+// snippet_stars, so only limit rows come back.
+//
+// Comments would make a good third signal, but snippets can't be commented on. If that
+// changes, they belong in the UNION below alongside the stars.
+func (m *SnippetModel) Trending(days int, limit int) ([]*TrendingSnippet, error) {
+	halfLife := float64(days) / 3
+
+	// The window is the last days days including today, so a star counts if it was given
+	// on or after the start of day (days - 1) ago: the same days as the views.
+	stmt := `SELECT s.id, s.title, s.publish_at, SUM(e.views), SUM(e.stars),
+    		SUM((e.views + ? * e.stars) / POW(2, DATEDIFF(UTC_DATE(), e.day) / ?)) AS score
+    		FROM (
+    			SELECT snippet_id, day, views, 0 AS stars FROM snippet_views
+    			WHERE day > DATE_SUB(UTC_DATE(), INTERVAL ? DAY)
+    			UNION ALL
+    			SELECT snippet_id, DATE(created), 0, 1 FROM snippet_stars
+    			WHERE created >= DATE_SUB(UTC_DATE(), INTERVAL ? DAY)
+    		) e INNER JOIN snippets s ON s.id = e.snippet_id
+    		WHERE s.expires > UTC_TIMESTAMP() AND s.hidden = FALSE AND s.publish_at <= UTC_TIMESTAMP() AND s.org_id IS NULL
+    		GROUP BY s.id, s.title, s.publish_at
+    		ORDER BY score DESC, s.id DESC LIMIT ?`
+
+	rows, err := m.DB.Query(stmt, starWeight, halfLife, days, days-1, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	trending := []*TrendingSnippet{}
+
+	for rows.Next() {
+		t := &TrendingSnippet{}
+		err = rows.Scan(&t.ID, &t.Title, &t.PublishAt, &t.Views, &t.Stars, &t.Score)
+		if err != nil {
+			return nil, err
+		}
+		trending = append(trending, t)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return trending, nil
+}
+
+// SetNoindex changes whether search engines are asked to skip a snippet.
+func (m *SnippetModel) SetNoindex(id int, noindex bool) error {
+	_, err := m.DB.Exec("UPDATE snippets SET noindex = ? WHERE id = ?", noindex, id)
+	return err
+}
+
+// SetLanguage records the language the owner says the snippet is written in, replacing
+// any guess we made. An empty language means "not set".
+func (m *SnippetModel) SetLanguage(id int, language string) error {
+	_, err := m.DB.Exec("UPDATE snippets SET language = ?, language_confidence = 1 WHERE id = ?", language, id)
+	return err
+}
+
+// Update replaces a snippet's title and content, for the owner or a co-editor. The content
+// is sealed afresh and the hash recomputed, the same way Insert does it. Client encrypted
+// snippets can't be edited here: we can't see their content to change it.
+func (m *SnippetModel) Update(id int, title string, content string, language string, confidence float64) error {
+	stored, keyID, dataKey, err := m.seal(content)
+	if err != nil {
+		return err
+	}
+
+	hash, hashKeyID := m.contentHash(content)
+
+	stmt := `UPDATE snippets SET title = ?, content = ?, content_hash = ?, hash_key_id = ?, language = ?, language_confidence = ?, key_id = ?, data_key = ?,
+			updated = UTC_TIMESTAMP()
+			WHERE id = ? AND client_encrypted = false`
+
+	_, err = m.DB.Exec(stmt, title, stored, hash, hashKeyID, language, confidence, keyID, dataKey, id)
+	return err
+}
+
+// CountIndexable returns how many snippets belong in the sitemap: those which anybody can
+// see and whose owners haven't opted out of indexing.
+func (m *SnippetModel) CountIndexable() (int, error) {
+	stmt := `SELECT COUNT(*) FROM snippets
+    		WHERE expires > UTC_TIMESTAMP() AND hidden = FALSE AND publish_at <= UTC_TIMESTAMP() AND noindex = FALSE AND org_id IS NULL`
+
+	var count int
+	err := m.DB.QueryRow(stmt).Scan(&count)
+	return count, err
+}
+
+// Indexable returns one page of the snippets counted by CountIndexable(), in ID order so
+// that the pages are stable between requests.
+func (m *SnippetModel) Indexable(offset, limit int) ([]*SitemapEntry, error) {
+	stmt := `SELECT id, publish_at FROM snippets
+    		WHERE expires > UTC_TIMESTAMP() AND hidden = FALSE AND publish_at <= UTC_TIMESTAMP() AND noindex = FALSE AND org_id IS NULL
+    		ORDER BY id ASC LIMIT ? OFFSET ?`
+
+	rows, err := m.DB.Query(stmt, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []*SitemapEntry{}
+
+	for rows.Next() {
+		e := &SitemapEntry{}
+		err = rows.Scan(&e.ID, &e.PublishAt)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
 /*
 REWRITE OF SnippetModel.Get()
 func (m *SnippetModel) Get(id int) (*Snippet, error) {
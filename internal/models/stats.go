@@ -0,0 +1,172 @@
+package models
+
+import (
+	"time"
+)
+
+// AccountStats summarises how a user's snippets are being used, for their stats page.
+type AccountStats struct {
+	Snippets int
+	Views    int
+	Stars    int // stars received, on all of the user's snippets
+	Top      []*TopSnippet
+	Daily    []*DailyActivity // one entry per day, oldest first, with no gaps
+}
+
+// A TopSnippet is one of a user's most viewed snippets, with its views and stars of all
+// time.
+type TopSnippet struct {
+	ID    int
+	Title string
+	Views int
+	Stars int
+}
+
+// DailyActivity counts a user's views and new snippets on one (UTC) day.
+type DailyActivity struct {
+	Day     time.Time
+	Views   int
+	Created int
+}
+
+// Stats gathers a user's statistics, with daily activity for the last days days
+// (including today). Expired and hidden snippets still count: they're part of the
+// user's history even if nobody can see them any more.
+func (m *SnippetModel) Stats(userID int, days int) (*AccountStats, error) {
+	stats := &AccountStats{}
+
+	err := m.DB.QueryRow("SELECT COUNT(*) FROM snippets WHERE user_id = ?", userID).Scan(&stats.Snippets)
+	if err != nil {
+		return nil, err
+	}
+
+	stmt := `SELECT IFNULL(SUM(v.views), 0) FROM snippet_views v
+    		INNER JOIN snippets s ON s.id = v.snippet_id WHERE s.user_id = ?`
+	err = m.DB.QueryRow(stmt, userID).Scan(&stats.Views)
+	if err != nil {
+		return nil, err
+	}
+
+	stmt = `SELECT COUNT(*) FROM snippet_stars st
+    		INNER JOIN snippets s ON s.id = st.snippet_id WHERE s.user_id = ?`
+	err = m.DB.QueryRow(stmt, userID).Scan(&stats.Stars)
+	if err != nil {
+		return nil, err
+	}
+
+	stats.Top, err = m.topSnippets(userID, 5)
+	if err != nil {
+		return nil, err
+	}
+
+	stats.Daily, err = m.dailyActivity(userID, days)
+	if err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+func (m *SnippetModel) topSnippets(userID int, limit int) ([]*TopSnippet, error) {
+	stmt := `SELECT s.id, s.title, SUM(v.views) AS total,
+    		(SELECT COUNT(*) FROM snippet_stars st WHERE st.snippet_id = s.id)
+    		FROM snippet_views v INNER JOIN snippets s ON s.id = v.snippet_id WHERE s.user_id = ?
+    		GROUP BY s.id, s.title ORDER BY total DESC, s.id DESC LIMIT ?`
+
+	rows, err := m.DB.Query(stmt, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	top := []*TopSnippet{}
+
+	for rows.Next() {
+		t := &TopSnippet{}
+		err = rows.Scan(&t.ID, &t.Title, &t.Views, &t.Stars)
+		if err != nil {
+			return nil, err
+		}
+		top = append(top, t)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return top, nil
+}
+
+// dailyActivity returns one entry for each of the last days days. The database only has
+// rows for days when something happened, so the days in between are filled in with zeros.
+func (m *SnippetModel) dailyActivity(userID int, days int) ([]*DailyActivity, error) {
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	first := today.AddDate(0, 0, -(days - 1))
+
+	daily := make([]*DailyActivity, days)
+	for i := range daily {
+		daily[i] = &DailyActivity{Day: first.AddDate(0, 0, i)}
+	}
+
+	// index finds a day's entry, or returns -1 for days outside the window.
+	index := func(day time.Time) int {
+		i := int(day.UTC().Sub(first).Hours() / 24)
+		if i < 0 || i >= days {
+			return -1
+		}
+		return i
+	}
+
+	stmt := `SELECT v.day, SUM(v.views) FROM snippet_views v
+    		INNER JOIN snippets s ON s.id = v.snippet_id
+    		WHERE s.user_id = ? AND v.day >= ? GROUP BY v.day`
+
+	rows, err := m.DB.Query(stmt, userID, first)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var day time.Time
+		var views int
+		err = rows.Scan(&day, &views)
+		if err != nil {
+			return nil, err
+		}
+		if i := index(day); i >= 0 {
+			daily[i].Views = views
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	stmt = `SELECT DATE(created), COUNT(*) FROM snippets
+    		WHERE user_id = ? AND created >= ? GROUP BY DATE(created)`
+
+	rows, err = m.DB.Query(stmt, userID, first)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var day time.Time
+		var created int
+		err = rows.Scan(&day, &created)
+		if err != nil {
+			return nil, err
+		}
+		if i := index(day); i >= 0 {
+			daily[i].Created = created
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return daily, nil
+}
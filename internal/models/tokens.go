@@ -0,0 +1,113 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// The things a token can be used for. A token for one scope is no good for another.
+const (
+	ScopePasswordReset = "password-reset"
+	ScopeActivation    = "activation"
+)
+
+type TokenModelInterface interface {
+	Insert(email, scope, token string, expires time.Time) error
+	UserID(token, scope string) (int, error)
+	Consume(token, scope string) (int, error)
+	LastIssued(userID int, scope string) (time.Time, error)
+}
+
+// TokenModel stores the one-time tokens we email out to users. Like invitation tokens,
+// only their SHA-256 hashes are kept, so somebody who can read the table still can't
+// use them.
+type TokenModel struct {
+	DB *sql.DB
+}
+
+// Insert stores a token for the user with the given email address. It returns
+// ErrNoRecord if nobody has signed up with that address.
+func (m *TokenModel) Insert(email, scope, token string, expires time.Time) error {
+	stmt := `INSERT INTO tokens (token_hash, user_id, scope, created, expires)
+    		SELECT ?, id, ?, UTC_TIMESTAMP(), ? FROM users WHERE email = ?`
+
+	result, err := m.DB.Exec(stmt, tokenHash(token), scope, expires.UTC(), email)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+// UserID returns the ID of the user a token was issued to, without using the token up.
+// It returns ErrNoRecord if the token doesn't exist, has expired or is for another scope.
+func (m *TokenModel) UserID(token, scope string) (int, error) {
+	var userID int
+
+	stmt := "SELECT user_id FROM tokens WHERE token_hash = ? AND scope = ? AND expires > UTC_TIMESTAMP()"
+
+	err := m.DB.QueryRow(stmt, tokenHash(token), scope).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrNoRecord
+		}
+		return 0, err
+	}
+
+	return userID, nil
+}
+
+// Consume uses a token up and returns the ID of the user it was issued to. Every other
+// token the user has for the same scope goes too: once one reset link has been used, the
+// older ones sitting in their inbox shouldn't keep working. Like UserID, it returns
+// ErrNoRecord if the token isn't valid.
+func (m *TokenModel) Consume(token, scope string) (int, error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var userID int
+
+	stmt := "SELECT user_id FROM tokens WHERE token_hash = ? AND scope = ? AND expires > UTC_TIMESTAMP() FOR UPDATE"
+
+	err = tx.QueryRow(stmt, tokenHash(token), scope).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrNoRecord
+		}
+		return 0, err
+	}
+
+	_, err = tx.Exec("DELETE FROM tokens WHERE user_id = ? AND scope = ?", userID, scope)
+	if err != nil {
+		return 0, err
+	}
+
+	return userID, tx.Commit()
+}
+
+// LastIssued returns when the newest unused token for the user and scope was created, or
+// the zero time if they don't have one. It's for rate limiting the emails we send.
+func (m *TokenModel) LastIssued(userID int, scope string) (time.Time, error) {
+	var created sql.NullTime
+
+	stmt := "SELECT MAX(created) FROM tokens WHERE user_id = ? AND scope = ? AND expires > UTC_TIMESTAMP()"
+
+	err := m.DB.QueryRow(stmt, userID, scope).Scan(&created)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return created.Time, nil
+}
@@ -0,0 +1,257 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"snippetbox/internal/envelope"
+)
+
+// TwoFactor is a user's authenticator app setup. Until they've proven it works by
+// entering a code, Enabled is false and logging in doesn't ask for one.
+type TwoFactor struct {
+	UserID  int
+	Secret  []byte
+	Enabled bool
+}
+
+type TwoFactorModelInterface interface {
+	Get(userID int) (*TwoFactor, error)
+	Begin(userID int, secret []byte) error
+	Enable(userID int, recoveryCodes []string) error
+	Disable(userID int) error
+	UseCounter(userID int, counter int64) (bool, error)
+	UseRecoveryCode(userID int, code string) (int, error)
+}
+
+// TwoFactorModel stores TOTP secrets, encrypted with the same keys as snippet content,
+// and the hashes of users' recovery codes.
+type TwoFactorModel struct {
+	DB   *sql.DB
+	Keys *envelope.Keyring
+}
+
+// Get returns the user's setup, or ErrNoRecord if they haven't started one.
+func (m *TwoFactorModel) Get(userID int) (*TwoFactor, error) {
+	var ciphertext, dataKey []byte
+	var keyID string
+
+	tf := &TwoFactor{UserID: userID}
+
+	stmt := "SELECT secret, key_id, data_key, enabled FROM user_totp WHERE user_id = ?"
+
+	err := m.DB.QueryRow(stmt, userID).Scan(&ciphertext, &keyID, &dataKey, &tf.Enabled)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
+	}
+
+	if m.Keys == nil {
+		return nil, ErrNoKeys
+	}
+
+	tf.Secret, err = m.Keys.Open(&envelope.Sealed{KeyID: keyID, DataKey: dataKey, Ciphertext: ciphertext})
+	if err != nil {
+		return nil, fmt.Errorf("models: TOTP secret for user %d: %w", userID, err)
+	}
+
+	return tf, nil
+}
+
+// Begin stores a new secret for the user, not yet enabled. It replaces any setup they
+// started before but didn't finish; it won't touch one which is enabled, which has to be
+// disabled first.
+func (m *TwoFactorModel) Begin(userID int, secret []byte) error {
+	if m.Keys == nil {
+		return ErrNoKeys
+	}
+
+	sealed, err := m.Keys.Seal(secret)
+	if err != nil {
+		return err
+	}
+
+	stmt := `INSERT INTO user_totp (user_id, secret, key_id, data_key, enabled, last_counter, created)
+    		VALUES (?, ?, ?, ?, FALSE, 0, UTC_TIMESTAMP())
+    		ON DUPLICATE KEY UPDATE
+    			secret = IF(enabled, secret, VALUES(secret)),
+    			key_id = IF(enabled, key_id, VALUES(key_id)),
+    			data_key = IF(enabled, data_key, VALUES(data_key)),
+    			created = IF(enabled, created, VALUES(created))`
+
+	_, err = m.DB.Exec(stmt, userID, sealed.Ciphertext, sealed.KeyID, sealed.DataKey)
+	return err
+}
+
+// Reencrypt moves up to limit TOTP secrets onto the current key, and returns how many it
+// moved. Only the data keys are re-wrapped; the secrets themselves stay as they are. Call
+// it until it returns 0.
+func (m *TwoFactorModel) Reencrypt(limit int) (int, error) {
+	if m.Keys == nil {
+		return 0, ErrNoKeys
+	}
+
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// Lock the batch, so that a user starting their setup over can't replace a secret
+	// between reading and rewriting it.
+	stmt := "SELECT user_id, key_id, data_key FROM user_totp WHERE key_id <> ? LIMIT ? FOR UPDATE"
+
+	rows, err := tx.Query(stmt, m.Keys.CurrentID(), limit)
+	if err != nil {
+		return 0, err
+	}
+
+	type wrapped struct {
+		userID  int
+		keyID   string
+		dataKey []byte
+	}
+
+	batch := []wrapped{}
+	for rows.Next() {
+		var w wrapped
+		err = rows.Scan(&w.userID, &w.keyID, &w.dataKey)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		batch = append(batch, w)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, w := range batch {
+		sealed, err := m.Keys.Rewrap(&envelope.Sealed{KeyID: w.keyID, DataKey: w.dataKey})
+		if err != nil {
+			return 0, fmt.Errorf("models: TOTP secret for user %d: %w", w.userID, err)
+		}
+
+		_, err = tx.Exec("UPDATE user_totp SET key_id = ?, data_key = ? WHERE user_id = ?", sealed.KeyID, sealed.DataKey, w.userID)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+
+	return len(batch), nil
+}
+
+// Enable turns on the user's setup and gives them a new set of recovery codes. Only
+// hashes of the codes are kept: they're as good as a password.
+func (m *TwoFactorModel) Enable(userID int, recoveryCodes []string) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("UPDATE user_totp SET enabled = TRUE WHERE user_id = ?", userID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNoRecord
+	}
+
+	_, err = tx.Exec("DELETE FROM recovery_codes WHERE user_id = ?", userID)
+	if err != nil {
+		return err
+	}
+
+	for _, code := range recoveryCodes {
+		_, err = tx.Exec("INSERT INTO recovery_codes (user_id, code_hash) VALUES (?, ?)", userID, tokenHash(normalizeRecoveryCode(code)))
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Disable removes the user's setup and their recovery codes.
+func (m *TwoFactorModel) Disable(userID int) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("DELETE FROM recovery_codes WHERE user_id = ?", userID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM user_totp WHERE user_id = ?", userID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UseCounter records that the code for the given period has been used, and reports
+// whether it's newer than the last one that was. A code is good for a minute or so, and
+// this stops anyone who sees one being used from using it again in that time.
+func (m *TwoFactorModel) UseCounter(userID int, counter int64) (bool, error) {
+	stmt := "UPDATE user_totp SET last_counter = ? WHERE user_id = ? AND last_counter < ?"
+
+	result, err := m.DB.Exec(stmt, counter, userID, counter)
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rows == 1, nil
+}
+
+// UseRecoveryCode uses up one of the user's recovery codes and returns how many they
+// have left. It returns ErrNoRecord if the code isn't one of theirs, or has been used.
+func (m *TwoFactorModel) UseRecoveryCode(userID int, code string) (int, error) {
+	result, err := m.DB.Exec("DELETE FROM recovery_codes WHERE user_id = ? AND code_hash = ?", userID, tokenHash(normalizeRecoveryCode(code)))
+	if err != nil {
+		return 0, err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if rows == 0 {
+		return 0, ErrNoRecord
+	}
+
+	var remaining int
+
+	err = m.DB.QueryRow("SELECT COUNT(*) FROM recovery_codes WHERE user_id = ?", userID).Scan(&remaining)
+	return remaining, err
+}
+
+// normalizeRecoveryCode lets people type recovery codes in either case, and with or
+// without the dash in the middle.
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
@@ -18,12 +18,20 @@ type User struct {
 	Email          string
 	HashedPassword []byte
 	Created        time.Time
+	Activated      bool // whether they've followed the link we emailed them on signup
 }
 
 type UserModelInterface interface {
 	Insert(name, email, password string) error
 	Authenticate(email, password string) (int, error)
 	Exists(id int) (bool, error)
+	IsAdmin(id int) (bool, error)
+	Get(id int) (*User, error)
+	PasswordUpdate(id int, currentPassword, newPassword string) error
+	PasswordSet(id int, newPassword string) error
+	Activated(id int) (bool, error)
+	Activate(id int) error
+	PasswordMatches(id int, password string) (bool, error)
 }
 
 // Define a new UserModel type which wraps a database connection pool.
@@ -68,10 +76,11 @@ func (m *UserModel) Authenticate(email, password string) (int, error) {
 	// If no matching email exists we return the ErrInvalidCredentials error.
 	var id int
 	var hashedPassword []byte
+	var suspended bool
 
-	stmt := "SELECT id, hashed_password FROM users WHERE email = ?"
+	stmt := "SELECT id, hashed_password, suspended FROM users WHERE email = ?"
 
-	err := m.DB.QueryRow(stmt, email).Scan(&id, &hashedPassword)
+	err := m.DB.QueryRow(stmt, email).Scan(&id, &hashedPassword, &suspended)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return 0, ErrInvalidCredentials
@@ -91,16 +100,139 @@ func (m *UserModel) Authenticate(email, password string) (int, error) {
 		}
 	}
 
+	// Only tell the user that they've been suspended once they have proven who they are.
+	if suspended {
+		return 0, ErrAccountSuspended
+	}
+
 	// Otherwise, the password is correct. Return the user ID.
 	return id, nil
 }
 
 // We'll use the Exists method to check if a user exists with a specifi ID.
+// Suspended users are treated as if they didn't exist, which logs them out everywhere.
 func (m *UserModel) Exists(id int) (bool, error) {
 	var exists bool
 
-	stmt := "SELECT EXISTS(SELECT true FROM users WHERE id = ?)"
+	stmt := "SELECT EXISTS(SELECT true FROM users WHERE id = ? AND suspended = FALSE)"
 
 	err := m.DB.QueryRow(stmt, id).Scan(&exists)
 	return exists, err
 }
+
+// IsAdmin reports whether the user with the given ID may use the moderation pages.
+func (m *UserModel) IsAdmin(id int) (bool, error) {
+	var admin bool
+
+	stmt := "SELECT EXISTS(SELECT true FROM users WHERE id = ? AND admin = TRUE)"
+
+	err := m.DB.QueryRow(stmt, id).Scan(&admin)
+	return admin, err
+}
+
+// Get fetches a user's details for their account page. The password hash is left out:
+// there's no reason for it to leave this package.
+func (m *UserModel) Get(id int) (*User, error) {
+	var user User
+
+	stmt := "SELECT id, name, email, created, activated FROM users WHERE id = ?"
+
+	err := m.DB.QueryRow(stmt, id).Scan(&user.ID, &user.Name, &user.Email, &user.Created, &user.Activated)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// PasswordUpdate changes a user's password, but only if currentPassword is the one they
+// have now. If it isn't, it returns ErrInvalidCredentials.
+func (m *UserModel) PasswordUpdate(id int, currentPassword, newPassword string) error {
+	var currentHashedPassword []byte
+
+	stmt := "SELECT hashed_password FROM users WHERE id = ?"
+
+	err := m.DB.QueryRow(stmt, id).Scan(&currentHashedPassword)
+	if err != nil {
+		return err
+	}
+
+	err = bcrypt.CompareHashAndPassword(currentHashedPassword, []byte(currentPassword))
+	if err != nil {
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return ErrInvalidCredentials
+		}
+		return err
+	}
+
+	newHashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), 12)
+	if err != nil {
+		return err
+	}
+
+	stmt = "UPDATE users SET hashed_password = ? WHERE id = ?"
+
+	_, err = m.DB.Exec(stmt, string(newHashedPassword), id)
+	return err
+}
+
+// PasswordSet changes a user's password without asking for the old one. It's for when
+// they've proven who they are some other way, like with a password reset link.
+func (m *UserModel) PasswordSet(id int, newPassword string) error {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), 12)
+	if err != nil {
+		return err
+	}
+
+	stmt := "UPDATE users SET hashed_password = ? WHERE id = ?"
+
+	_, err = m.DB.Exec(stmt, string(hashedPassword), id)
+	return err
+}
+
+// Activated reports whether the user has verified their email address.
+func (m *UserModel) Activated(id int) (bool, error) {
+	var activated bool
+
+	stmt := "SELECT EXISTS(SELECT true FROM users WHERE id = ? AND activated = TRUE)"
+
+	err := m.DB.QueryRow(stmt, id).Scan(&activated)
+	return activated, err
+}
+
+// Activate records that the user has verified their email address.
+func (m *UserModel) Activate(id int) error {
+	stmt := "UPDATE users SET activated = TRUE WHERE id = ?"
+
+	_, err := m.DB.Exec(stmt, id)
+	return err
+}
+
+// PasswordMatches reports whether password is the user's current password. It's for
+// asking someone who is already logged in to confirm it's really them.
+func (m *UserModel) PasswordMatches(id int, password string) (bool, error) {
+	var hashedPassword []byte
+
+	stmt := "SELECT hashed_password FROM users WHERE id = ?"
+
+	err := m.DB.QueryRow(stmt, id).Scan(&hashedPassword)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	err = bcrypt.CompareHashAndPassword(hashedPassword, []byte(password))
+	if err != nil {
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
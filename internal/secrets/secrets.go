@@ -0,0 +1,145 @@
+package secrets
+
+import (
+	"math"
+	"regexp"
+	"strings"
+)
+
+// A Finding records that a detector matched something on a line of content. Line numbers
+// start at 1, the same way an editor shows them.
+type Finding struct {
+	Line     int
+	Detector string
+}
+
+// A Detector looks at a single line of content and reports whether it appears to
+// contain a secret. New kinds of secret can be caught by adding a Detector to the
+// Scanner, without touching the code which calls Scan().
+type Detector interface {
+	Name() string
+	Detect(line string) bool
+}
+
+// Scanner runs every one of its detectors over each line of the content.
+type Scanner struct {
+	Detectors []Detector
+}
+
+// NewScanner returns a Scanner which uses the given detectors. Call it with
+// DefaultDetectors()... for the standard set.
+func NewScanner(detectors ...Detector) *Scanner {
+	return &Scanner{Detectors: detectors}
+}
+
+// Scan returns a Finding for each line that at least one detector matched. Only the
+// first matching detector is reported for a line, so a private key doesn't also show up
+// as a high-entropy string.
+func (s *Scanner) Scan(content string) []Finding {
+	findings := []Finding{}
+
+	for i, line := range strings.Split(content, "\n") {
+		for _, d := range s.Detectors {
+			if d.Detect(line) {
+				findings = append(findings, Finding{Line: i + 1, Detector: d.Name()})
+				break
+			}
+		}
+	}
+
+	return findings
+}
+
+// RegexDetector matches lines against a regular expression.
+type RegexDetector struct {
+	Label string
+	RX    *regexp.Regexp
+}
+
+func (d *RegexDetector) Name() string {
+	return d.Label
+}
+
+func (d *RegexDetector) Detect(line string) bool {
+	return d.RX.MatchString(line)
+}
+
+// EntropyDetector flags long, random-looking tokens such as API keys and passwords which
+// don't have a recognisable format. A token is any run of characters from Charset at least
+// MinLength long, and it is flagged if its Shannon entropy (in bits per character) is at
+// least Threshold.
+type EntropyDetector struct {
+	Label     string
+	Charset   string
+	MinLength int
+	Threshold float64
+}
+
+func (d *EntropyDetector) Name() string {
+	return d.Label
+}
+
+func (d *EntropyDetector) Detect(line string) bool {
+	tokens := strings.FieldsFunc(line, func(r rune) bool {
+		return !strings.ContainsRune(d.Charset, r)
+	})
+
+	for _, token := range tokens {
+		if len(token) >= d.MinLength && entropy(token) >= d.Threshold {
+			return true
+		}
+	}
+
+	return false
+}
+
+// entropy returns the Shannon entropy of s in bits per character.
+func entropy(s string) float64 {
+	counts := map[rune]int{}
+	for _, r := range s {
+		counts[r]++
+	}
+
+	var e float64
+	n := float64(len(s))
+	for _, c := range counts {
+		p := float64(c) / n
+		e -= p * math.Log2(p)
+	}
+
+	return e
+}
+
+// base64Charset covers both the standard and URL-safe base64 alphabets. Hex strings fall
+// inside it too, but a hex string tops out at 4 bits per character, below the threshold
+// we use, so git hashes and checksums aren't reported.
+const base64Charset = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/=_-"
+
+// DefaultDetectors returns the detectors used on snippet creation: well-known credential
+// formats first, then the entropy checks as a catch-all.
+func DefaultDetectors() []Detector {
+	return []Detector{
+		&RegexDetector{
+			Label: "private key",
+			RX:    regexp.MustCompile(`-----BEGIN ([A-Z0-9]+ )*PRIVATE KEY( BLOCK)?-----`),
+		},
+		&RegexDetector{
+			Label: "AWS access key ID",
+			RX:    regexp.MustCompile(`\b(AKIA|ASIA|AGPA|AIDA|AROA|ANPA|ANVA)[0-9A-Z]{16}\b`),
+		},
+		&RegexDetector{
+			Label: "AWS secret access key",
+			RX:    regexp.MustCompile(`(?i)aws.{0,20}(secret|private).{0,20}['"=:\s][A-Za-z0-9/+]{40}\b`),
+		},
+		&RegexDetector{
+			Label: "JSON Web Token",
+			RX:    regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{5,}\.eyJ[A-Za-z0-9_-]{5,}\.[A-Za-z0-9_-]{10,}`),
+		},
+		&EntropyDetector{
+			Label:     "high-entropy string",
+			Charset:   base64Charset,
+			MinLength: 20,
+			Threshold: 4.5,
+		},
+	}
+}
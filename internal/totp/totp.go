@@ -0,0 +1,109 @@
+// Package totp implements the time-based one-time passwords of RFC 6238, as used by
+// authenticator apps: six digits, from HMAC-SHA1, changing every 30 seconds.
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+const (
+	// Period is how long each code lasts.
+	Period = 30 * time.Second
+
+	// Digits is how long the codes are.
+	Digits = 6
+
+	// Skew is how many periods either side of the current one we accept codes from, to
+	// allow for clocks which are a little out and people who type slowly.
+	Skew = 1
+)
+
+// The secrets are shown to users in base32, which is what authenticator apps expect.
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// NewSecret returns a new random 160 bit secret, the size RFC 4226 recommends.
+func NewSecret() ([]byte, error) {
+	secret := make([]byte, 20)
+	_, err := rand.Read(secret)
+	if err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
+
+// EncodeSecret returns the secret in the form people type into their authenticator app
+// when they can't scan the QR code.
+func EncodeSecret(secret []byte) string {
+	return encoding.EncodeToString(secret)
+}
+
+// URL returns the otpauth:// URL which goes in the QR code. issuer is the name the
+// account is listed under in the app, and account tells the user's accounts apart.
+func URL(issuer, account string, secret []byte) string {
+	v := url.Values{}
+	v.Set("secret", EncodeSecret(secret))
+	v.Set("issuer", issuer)
+	v.Set("algorithm", "SHA1")
+	v.Set("digits", fmt.Sprint(Digits))
+	v.Set("period", fmt.Sprint(int(Period.Seconds())))
+
+	u := url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + issuer + ":" + account,
+		RawQuery: v.Encode(),
+	}
+	return u.String()
+}
+
+// Counter returns the number of the period t falls in.
+func Counter(t time.Time) int64 {
+	return t.Unix() / int64(Period.Seconds())
+}
+
+// Code returns the code for the period t falls in.
+func Code(secret []byte, t time.Time) string {
+	return code(secret, Counter(t))
+}
+
+// Validate checks a code against the periods around t. If it matches, it returns the
+// counter of the period it matched, so that the caller can refuse to accept the same code
+// (or an older one) twice.
+func Validate(secret []byte, candidate string, t time.Time) (int64, bool) {
+	if len(candidate) != Digits {
+		return 0, false
+	}
+
+	now := Counter(t)
+	for counter := now - Skew; counter <= now+Skew; counter++ {
+		if subtle.ConstantTimeCompare([]byte(code(secret, counter)), []byte(candidate)) == 1 {
+			return counter, true
+		}
+	}
+
+	return 0, false
+}
+
+// code is the HOTP algorithm from RFC 4226: an HMAC of the counter, dynamically truncated
+// to a number.
+func code(secret []byte, counter int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(counter))
+
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	return fmt.Sprintf("%0*d", Digits, value%1000000)
+}
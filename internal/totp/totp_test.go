@@ -0,0 +1,66 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"snippetbox/internal/assert"
+)
+
+// The SHA-1 test vectors from RFC 6238, appendix B, cut down to six digits.
+func TestCode(t *testing.T) {
+	secret := []byte("12345678901234567890")
+
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, Code(secret, time.Unix(tt.unix, 0)), tt.want)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret := []byte("12345678901234567890")
+	now := time.Unix(1111111111, 0)
+
+	tests := []struct {
+		name   string
+		code   string
+		wantOK bool
+	}{
+		{"Current", Code(secret, now), true},
+		{"Previous period", Code(secret, now.Add(-Period)), true},
+		{"Next period", Code(secret, now.Add(Period)), true},
+		{"Too old", Code(secret, now.Add(-3*Period)), false},
+		{"Wrong", "000000", false},
+		{"Too short", "12345", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, ok := Validate(secret, tt.code, now)
+			assert.Equal(t, ok, tt.wantOK)
+		})
+	}
+
+	counter, _ := Validate(secret, Code(secret, now.Add(-Period)), now)
+	assert.Equal(t, counter, Counter(now)-1)
+}
+
+func TestURL(t *testing.T) {
+	u := URL("Snippetbox", "alice@example.com", []byte("12345678901234567890"))
+
+	assert.Equal(t, strings.HasPrefix(u, "otpauth://totp/Snippetbox:alice@example.com?"), true)
+	assert.Equal(t, strings.Contains(u, "secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"), true)
+	assert.Equal(t, strings.Contains(u, "issuer=Snippetbox"), true)
+}
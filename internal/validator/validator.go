@@ -3,6 +3,7 @@ package validator
 import (
 	"regexp"
 	"strings"
+	"unicode"
 	"unicode/utf8"
 )
 
@@ -55,6 +56,12 @@ func MaxChars(value string, n int) bool {
 	return utf8.RuneCountInString(value) <= n
 }
 
+// NoControlChars() returns true if a value contains no control characters, such as line
+// breaks or tabs.
+func NoControlChars(value string) bool {
+	return strings.IndexFunc(value, unicode.IsControl) < 0
+}
+
 // PermittedValue returs true if the value type of T equals one of the variadic
 // permittedValues parameters.
 func PermittedValue[T comparable](value T, permittedValues ...T) bool {
@@ -74,6 +81,19 @@ func PermittedValue[T comparable](value T, permittedValues ...T) bool {
 // variable is more performant than re-parsing the pattern each time we need it.
 var EmailRX = regexp.MustCompile("^[a-zA-Z0-9.!#$%&'*+\\/=?^_`{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$")
 
+// AliasRX matches the aliases snippets can be given: 3 to 64 lowercase letters, digits
+// and dashes, not starting or ending with a dash.
+var AliasRX = regexp.MustCompile("^[a-z0-9][a-z0-9-]{1,62}[a-z0-9]$")
+
+// TagRX matches the tags snippets can be filed under: 1 to 32 lowercase letters, digits
+// and dashes, starting with a letter or digit.
+var TagRX = regexp.MustCompile("^[a-z0-9][a-z0-9-]{0,31}$")
+
+// CiphertextRX matches the content of a snippet encrypted in the browser: a version
+// prefix, then the IV and AES-GCM ciphertext in unpadded base64url. 38 characters is
+// the IV and authentication tag of an empty message.
+var CiphertextRX = regexp.MustCompile("^v1:[A-Za-z0-9_-]{38,}$")
+
 // MinChars() returns true if a value contains at least n characters.
 func MinChars(value string, n int) bool {
 	return utf8.RuneCountInString(value) >= n
@@ -0,0 +1,244 @@
+-- Schema changes for the snippetbox database. Run these, in order, against an
+-- existing database which already has the snippets, users and sessions tables.
+
+-- Record which user created each snippet. Snippets created before this change
+-- have no owner and keep a NULL user_id.
+ALTER TABLE snippets ADD COLUMN user_id INTEGER NULL;
+ALTER TABLE snippets ADD CONSTRAINT snippets_fk_user_id FOREIGN KEY (user_id) REFERENCES users(id);
+CREATE INDEX idx_snippets_user_id ON snippets(user_id);
+
+-- Moderation. Admins can review reported snippets, hide them or suspend their authors.
+-- Every decision is recorded in moderation_actions.
+ALTER TABLE users ADD COLUMN admin BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE users ADD COLUMN suspended BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE snippets ADD COLUMN hidden BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE TABLE reports (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    snippet_id INTEGER NOT NULL,
+    reporter_id INTEGER NOT NULL,
+    reason TEXT NOT NULL,
+    created DATETIME NOT NULL,
+    resolved BOOLEAN NOT NULL DEFAULT FALSE,
+    CONSTRAINT reports_fk_snippet_id FOREIGN KEY (snippet_id) REFERENCES snippets(id) ON DELETE CASCADE,
+    CONSTRAINT reports_fk_reporter_id FOREIGN KEY (reporter_id) REFERENCES users(id)
+);
+
+CREATE INDEX idx_reports_resolved ON reports(resolved);
+
+CREATE TABLE moderation_actions (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    report_id INTEGER NOT NULL,
+    snippet_id INTEGER NOT NULL,
+    moderator_id INTEGER NOT NULL,
+    action VARCHAR(20) NOT NULL,
+    created DATETIME NOT NULL,
+    CONSTRAINT moderation_actions_fk_report_id FOREIGN KEY (report_id) REFERENCES reports(id) ON DELETE CASCADE,
+    CONSTRAINT moderation_actions_fk_moderator_id FOREIGN KEY (moderator_id) REFERENCES users(id)
+);
+
+-- SHA-256 of each snippet's content, hex encoded. Used to spot a user posting the same
+-- snippet twice, and as the ETag for /snippet/raw.
+ALTER TABLE snippets ADD COLUMN content_hash CHAR(64) NOT NULL DEFAULT '';
+UPDATE snippets SET content_hash = SHA2(content, 256);
+CREATE INDEX idx_snippets_user_id_content_hash ON snippets(user_id, content_hash);
+
+-- Optional human-friendly aliases, served at /s/:alias.
+ALTER TABLE snippets ADD COLUMN alias VARCHAR(64) NULL;
+ALTER TABLE snippets ADD CONSTRAINT snippets_uc_alias UNIQUE (alias);
+
+-- Set once an expiry reminder has been emailed for the snippet's current expiry date,
+-- and cleared again when the snippet is extended.
+ALTER TABLE snippets ADD COLUMN reminder_sent BOOLEAN NOT NULL DEFAULT FALSE;
+CREATE INDEX idx_snippets_expires ON snippets(expires);
+
+-- Snippets can be scheduled for later publication. Until publish_at only the owner can see
+-- them. Existing snippets count as published when they were created.
+ALTER TABLE snippets ADD COLUMN publish_at DATETIME NULL;
+UPDATE snippets SET publish_at = created;
+ALTER TABLE snippets MODIFY publish_at DATETIME NOT NULL;
+CREATE INDEX idx_snippets_publish_at ON snippets(publish_at);
+
+-- Page views per snippet per day, for the trending page. Daily buckets keep the table small
+-- while still letting older views count for less.
+CREATE TABLE snippet_views (
+    snippet_id INTEGER NOT NULL,
+    day DATE NOT NULL,
+    views INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (snippet_id, day),
+    CONSTRAINT snippet_views_fk_snippet_id FOREIGN KEY (snippet_id) REFERENCES snippets(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_snippet_views_day ON snippet_views(day);
+
+-- Owners can ask search engines not to index a snippet.
+ALTER TABLE snippets ADD COLUMN noindex BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- The language a snippet is written in. Either chosen by its owner (confidence 1) or
+-- guessed from the content when the snippet is created.
+ALTER TABLE snippets ADD COLUMN language VARCHAR(32) NOT NULL DEFAULT '';
+ALTER TABLE snippets ADD COLUMN language_confidence FLOAT NOT NULL DEFAULT 0;
+
+-- Snippet content can be encrypted at rest. key_id names the master key which wraps the
+-- row's data key (stored wrapped in data_key), and is empty for rows stored as plain text.
+-- Encrypted content is base64 encoded, so the column is widened to leave room for it.
+ALTER TABLE snippets MODIFY content MEDIUMTEXT NOT NULL;
+ALTER TABLE snippets ADD COLUMN key_id VARCHAR(32) NOT NULL DEFAULT '';
+ALTER TABLE snippets ADD COLUMN data_key VARBINARY(128) NULL;
+CREATE INDEX idx_snippets_key_id ON snippets(key_id);
+
+-- Snippets encrypted in the browser. Their content is ciphertext we have no key for.
+ALTER TABLE snippets ADD COLUMN client_encrypted BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Owners can share a snippet with other users, letting them view it (even before it's
+-- published) or edit it too.
+CREATE TABLE snippet_acl (
+    snippet_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    permission ENUM('view', 'edit') NOT NULL,
+    created DATETIME NOT NULL,
+    PRIMARY KEY (snippet_id, user_id),
+    CONSTRAINT snippet_acl_fk_snippet_id FOREIGN KEY (snippet_id) REFERENCES snippets(id) ON DELETE CASCADE,
+    CONSTRAINT snippet_acl_fk_user_id FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_snippet_acl_user_id ON snippet_acl(user_id);
+
+-- Organizations: groups of users with a shared space for snippets. Snippets posted to an
+-- organization have its org_id, and only its members can see them.
+CREATE TABLE orgs (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    name VARCHAR(100) NOT NULL,
+    slug VARCHAR(64) NOT NULL,
+    created DATETIME NOT NULL
+);
+
+ALTER TABLE orgs ADD CONSTRAINT orgs_uc_slug UNIQUE (slug);
+
+CREATE TABLE org_members (
+    org_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    role ENUM('owner', 'admin', 'member') NOT NULL,
+    joined DATETIME NOT NULL,
+    PRIMARY KEY (org_id, user_id),
+    CONSTRAINT org_members_fk_org_id FOREIGN KEY (org_id) REFERENCES orgs(id) ON DELETE CASCADE,
+    CONSTRAINT org_members_fk_user_id FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_org_members_user_id ON org_members(user_id);
+
+-- Invitations to join an organization, sent by email. Only a hash of the emailed token is
+-- kept. Accepting an invitation deletes it.
+CREATE TABLE org_invitations (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    org_id INTEGER NOT NULL,
+    email VARCHAR(255) NOT NULL,
+    role ENUM('owner', 'admin', 'member') NOT NULL,
+    token_hash BINARY(32) NOT NULL,
+    created DATETIME NOT NULL,
+    expires DATETIME NOT NULL,
+    CONSTRAINT org_invitations_fk_org_id FOREIGN KEY (org_id) REFERENCES orgs(id) ON DELETE CASCADE
+);
+
+ALTER TABLE org_invitations ADD CONSTRAINT org_invitations_uc_org_email UNIQUE (org_id, email);
+ALTER TABLE org_invitations ADD CONSTRAINT org_invitations_uc_token_hash UNIQUE (token_hash);
+
+ALTER TABLE snippets ADD COLUMN org_id INTEGER NULL;
+ALTER TABLE snippets ADD CONSTRAINT snippets_fk_org_id FOREIGN KEY (org_id) REFERENCES orgs(id);
+CREATE INDEX idx_snippets_org_id ON snippets(org_id);
+
+-- One-time tokens emailed to users, such as password reset links. As with invitations,
+-- only a hash of the token is kept, and using a token deletes it.
+CREATE TABLE tokens (
+    token_hash BINARY(32) NOT NULL PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    scope VARCHAR(32) NOT NULL,
+    expires DATETIME NOT NULL,
+    CONSTRAINT tokens_fk_user_id FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_tokens_user_scope ON tokens(user_id, scope);
+
+-- Whether the user has followed the link emailed to them on signup. Accounts which
+-- already exist are trusted as they are.
+ALTER TABLE users ADD COLUMN activated BOOLEAN NOT NULL DEFAULT FALSE;
+UPDATE users SET activated = TRUE;
+
+-- When each token was issued, so that activation emails can't be resent too often. Like
+-- every other time in the schema it's UTC: TokenModel.Insert sets it with UTC_TIMESTAMP(),
+-- and the reset tokens already there are filled in the same way before it's made NOT NULL.
+ALTER TABLE tokens ADD COLUMN created DATETIME NULL AFTER scope;
+UPDATE tokens SET created = UTC_TIMESTAMP();
+ALTER TABLE tokens MODIFY created DATETIME NOT NULL;
+
+-- Two-factor authentication with an authenticator app. The TOTP secret is encrypted like
+-- snippet content. last_counter is the time step of the last code used, so that a code
+-- can't be used twice.
+CREATE TABLE user_totp (
+    user_id INTEGER NOT NULL PRIMARY KEY,
+    secret VARBINARY(128) NOT NULL,
+    key_id VARCHAR(32) NOT NULL,
+    data_key VARBINARY(128) NOT NULL,
+    enabled BOOLEAN NOT NULL DEFAULT FALSE,
+    last_counter BIGINT NOT NULL DEFAULT 0,
+    created DATETIME NOT NULL,
+    CONSTRAINT user_totp_fk_user_id FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- Single-use codes for logging in without the authenticator app. Only hashes are kept.
+CREATE TABLE recovery_codes (
+    user_id INTEGER NOT NULL,
+    code_hash BINARY(32) NOT NULL,
+    PRIMARY KEY (user_id, code_hash),
+    CONSTRAINT recovery_codes_fk_user_id FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- Failed logins, counted by account (the email address typed in, whether or not anyone
+-- has signed up with it) and by IP address. Logins are refused for a while after too
+-- many failures, for longer the more there have been.
+CREATE TABLE login_attempts (
+    scope ENUM('account', 'ip') NOT NULL,
+    attempt_key VARCHAR(255) NOT NULL,
+    failures INTEGER NOT NULL,
+    last_failure DATETIME NOT NULL,
+    PRIMARY KEY (scope, attempt_key)
+);
+
+-- Short labels snippets are filed under. Tags are lowercase, so the primary key also stops
+-- a snippet having the same tag twice.
+CREATE TABLE snippet_tags (
+    snippet_id INTEGER NOT NULL,
+    tag VARCHAR(32) NOT NULL,
+    PRIMARY KEY (snippet_id, tag),
+    CONSTRAINT snippet_tags_fk_snippet_id FOREIGN KEY (snippet_id) REFERENCES snippets(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_snippet_tags_tag ON snippet_tags(tag);
+
+-- Stars given to snippets by logged in users, one per user per snippet. They count towards
+-- the trending page, and towards the owner's stats.
+CREATE TABLE snippet_stars (
+    snippet_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    created DATETIME NOT NULL,
+    PRIMARY KEY (snippet_id, user_id),
+    CONSTRAINT snippet_stars_fk_snippet_id FOREIGN KEY (snippet_id) REFERENCES snippets(id) ON DELETE CASCADE,
+    CONSTRAINT snippet_stars_fk_user_id FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_snippet_stars_created ON snippet_stars(created);
+
+-- content_hash is an HMAC under the encryption key named here, rather than a plain SHA-256
+-- which anyone with a copy of the database could check guesses at the content against.
+-- Existing rows keep their plain hashes (an empty hash_key_id) until cmd/reencrypt redoes
+-- them.
+ALTER TABLE snippets ADD COLUMN hash_key_id VARCHAR(32) NOT NULL DEFAULT '';
+CREATE INDEX idx_snippets_hash_key_id ON snippets(hash_key_id);
+
+-- Password reset requests are limited per address and per IP, using the same counts as
+-- failed logins.
+ALTER TABLE login_attempts MODIFY scope ENUM('account', 'ip', 'reset-email', 'reset-ip') NOT NULL;
+
+-- When a snippet's content was last edited, or NULL if it never has been. The raw view
+-- sends it as Last-Modified.
+ALTER TABLE snippets ADD COLUMN updated DATETIME NULL;
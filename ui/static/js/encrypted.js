@@ -0,0 +1,146 @@
+// Client-side encryption for snippets. The browser encrypts the content with a fresh
+// AES-GCM key before the create form is sent, and the key only ever travels in the URL
+// fragment, which browsers never send to the server. The view page reads the key back out
+// of the fragment and decrypts the content here.
+//
+// The stored format is "v1:" followed by the 12 byte IV and the ciphertext, in unpadded
+// base64url. The key is the raw 256 bit AES key, also in unpadded base64url.
+(function () {
+	"use strict";
+
+	var PREFIX = "v1:";
+	var IV_CHARS = 16; // 12 bytes of IV in base64url
+
+	function toBase64url(bytes) {
+		var s = "";
+		for (var i = 0; i < bytes.length; i++) {
+			s += String.fromCharCode(bytes[i]);
+		}
+		return btoa(s).replace(/\+/g, "-").replace(/\//g, "_").replace(/=+$/, "");
+	}
+
+	function fromBase64url(s) {
+		var b = atob(s.replace(/-/g, "+").replace(/_/g, "/"));
+		var bytes = new Uint8Array(b.length);
+		for (var i = 0; i < b.length; i++) {
+			bytes[i] = b.charCodeAt(i);
+		}
+		return bytes;
+	}
+
+	// Remember the key for a snippet we've just encrypted, so the view page we're redirected
+	// to can put it into the fragment. Keys are filed under the snippet's IV.
+	function storageKey(ciphertext) {
+		return "snippetbox-key:" + ciphertext.slice(PREFIX.length, PREFIX.length + IV_CHARS);
+	}
+
+	function encrypt(text) {
+		var iv = crypto.getRandomValues(new Uint8Array(12));
+		var params = {name: "AES-GCM", iv: iv};
+
+		return crypto.subtle.generateKey({name: "AES-GCM", length: 256}, true, ["encrypt"]).then(function (key) {
+			return Promise.all([
+				crypto.subtle.encrypt(params, key, new TextEncoder().encode(text)),
+				crypto.subtle.exportKey("raw", key)
+			]);
+		}).then(function (results) {
+			var sealed = new Uint8Array(iv.length + results[0].byteLength);
+			sealed.set(iv);
+			sealed.set(new Uint8Array(results[0]), iv.length);
+
+			return {
+				ciphertext: PREFIX + toBase64url(sealed),
+				key: toBase64url(new Uint8Array(results[1]))
+			};
+		});
+	}
+
+	function decrypt(ciphertext, key) {
+		var sealed = fromBase64url(ciphertext.slice(PREFIX.length));
+		var params = {name: "AES-GCM", iv: sealed.slice(0, 12)};
+
+		return crypto.subtle.importKey("raw", fromBase64url(key), "AES-GCM", false, ["decrypt"]).then(function (k) {
+			return crypto.subtle.decrypt(params, k, sealed.slice(12));
+		}).then(function (plaintext) {
+			return new TextDecoder().decode(plaintext);
+		});
+	}
+
+	// On the create page, swap the content for ciphertext on the way out. The textarea
+	// loses its name so the plain text isn't sent alongside it.
+	var form = document.querySelector("form[data-encryptable]");
+	if (form) {
+		// Formatting happens on the server, so it isn't available for encrypted content.
+		var box = form.querySelector("input[name=client_encrypted]");
+		var formatButton = form.querySelector("button[name=action][value=format]");
+		if (formatButton) {
+			formatButton.disabled = box.checked;
+			box.addEventListener("change", function () {
+				formatButton.disabled = box.checked;
+			});
+		}
+
+		form.addEventListener("submit", function (e) {
+			if (!box.checked) {
+				return;
+			}
+			e.preventDefault();
+
+			var textarea = form.querySelector("textarea[name=content]");
+			encrypt(textarea.value).then(function (result) {
+				var hidden = document.createElement("input");
+				hidden.type = "hidden";
+				hidden.name = "content";
+				hidden.value = result.ciphertext;
+
+				textarea.removeAttribute("name");
+				form.appendChild(hidden);
+				sessionStorage.setItem(storageKey(result.ciphertext), result.key);
+
+				// submit() doesn't fire the submit event again.
+				form.submit();
+			});
+		});
+	}
+
+	// On the view page, decrypt the content and lay it out in numbered lines, the same way
+	// the server does for other snippets.
+	var code = document.querySelector("code[data-ciphertext]");
+	if (code) {
+		var ciphertext = code.getAttribute("data-ciphertext");
+		var status = code.querySelector(".status");
+		var key = window.location.hash.slice(1);
+
+		// Straight after creating the snippet, the key is waiting for us in session storage.
+		if (!key) {
+			key = sessionStorage.getItem(storageKey(ciphertext)) || "";
+			if (key) {
+				sessionStorage.removeItem(storageKey(ciphertext));
+				history.replaceState(null, "", "#" + key);
+			}
+		}
+
+		if (!key) {
+			status.textContent = "The key isn't in this link, so the snippet can't be decrypted. Ask whoever shared it for the full link, including the part after the #.";
+			return;
+		}
+
+		decrypt(ciphertext, key).then(function (text) {
+			code.textContent = "";
+
+			var lines = text.replace(/\n$/, "").split("\n");
+			for (var i = 0; i < lines.length; i++) {
+				// The numbers aren't links: the fragment is taken by the key.
+				var line = document.createElement("span");
+				var number = document.createElement("a");
+				line.className = "line";
+				number.textContent = i + 1;
+				line.appendChild(number);
+				line.appendChild(document.createTextNode(lines[i]));
+				code.appendChild(line);
+			}
+		}).catch(function () {
+			status.textContent = "This snippet couldn't be decrypted. The key in the link may be incomplete.";
+		});
+	}
+})();